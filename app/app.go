@@ -0,0 +1,240 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/config"
+	controller "github.com/datmedevil17/restaurant-management/controllers"
+	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	"github.com/datmedevil17/restaurant-management/logging"
+	"github.com/datmedevil17/restaurant-management/metrics"
+	"github.com/datmedevil17/restaurant-management/middlewares"
+	model "github.com/datmedevil17/restaurant-management/models"
+	notifier "github.com/datmedevil17/restaurant-management/notifiers"
+	"github.com/datmedevil17/restaurant-management/openapi"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"github.com/datmedevil17/restaurant-management/routes"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// App is a fully wired server: its configuration, the Mongo client backing
+// the repositories and the router serving them.
+type App struct {
+	Config config.Config
+	Client *mongo.Client
+	Router *mux.Router
+	Logger *slog.Logger
+}
+
+// New connects to MongoDB and wires the routers for cfg.
+func New(ctx context.Context, cfg config.Config) (*App, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	client, err := database.Connect(ctx, cfg.MongoURI, cfg.ConnectTimeout, metrics.CommandMonitor())
+	if err != nil {
+		return nil, err
+	}
+
+	db := client.Database(cfg.Database)
+	if err := repository.EnsureIndexes(ctx, db); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("creating indexes: %w", err)
+	}
+
+	repos := repository.NewMongo(db)
+	a, err := newApp(cfg, repos, map[string]func(context.Context) error{
+		"mongodb": database.Ping(client),
+	})
+	if err != nil {
+		client.Disconnect(context.Background())
+		return nil, err
+	}
+	a.Client = client
+	return a, nil
+}
+
+// NewWithRepositories wires the routers on top of repos without touching
+// MongoDB, e.g. with repository.NewMemory() for tests and offline demos.
+func NewWithRepositories(cfg config.Config, repos *repository.Repositories) (*App, error) {
+	return newApp(cfg, repos, nil)
+}
+
+// newApp wires the routers on top of repos, with /readyz probing checks.
+func newApp(cfg config.Config, repos *repository.Repositories, checks map[string]func(context.Context) error) (*App, error) {
+	logger := logging.New(os.Stdout, cfg.Environment, cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	keys, err := newKeySet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	helpers.SetKeyProvider(keys)
+
+	revocations := helpers.NewRevocationList(repos.Revocations, cfg.RevocationCacheTTL)
+	logins := &helpers.LoginThrottle{
+		Store:         helpers.NewMemoryAttemptStore(cfg.LoginLockout),
+		MaxFailures:   cfg.LoginMaxFailures,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		BaseDelay:     cfg.LoginBackoff,
+		Lockout:       cfg.LoginLockout,
+	}
+	// Every reset or verification mail counts against the same limits as a
+	// failed login, so nobody can flood an address through the API.
+	mails := &helpers.LoginThrottle{
+		Store:         helpers.NewMemoryAttemptStore(cfg.LoginLockout),
+		MaxFailures:   cfg.LoginMaxFailures,
+		IPMaxFailures: cfg.LoginIPMaxFailures,
+		BaseDelay:     cfg.LoginBackoff,
+		Lockout:       cfg.LoginLockout,
+	}
+
+	passwords, policy, err := newPasswords(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var notify notifier.Notifier = notifier.LogNotifier{}
+	if cfg.NotifyFile != "" {
+		notify = &notifier.FileNotifier{Path: cfg.NotifyFile}
+	}
+
+	return &App{
+		Config: cfg,
+		Router: NewRouter(controller.New(repos, controller.Services{
+			Revocations:    revocations,
+			Logins:         logins,
+			Mails:          mails,
+			Notifier:       notify,
+			Passwords:      passwords,
+			PasswordPolicy: policy,
+			MFA: controller.MFASettings{
+				Issuer:        cfg.MFAIssuer,
+				RequiredRoles: cfg.MFARequiredRoles,
+				PendingTTL:    cfg.MFAPendingTTL,
+			},
+			Readiness: controller.Readiness{
+				Checks:  checks,
+				Timeout: cfg.ReadinessTimeout,
+			},
+			TrustedProxies: cfg.TrustedProxies,
+		}), revocations, repos.APIKeys, logger),
+		Logger: logger,
+	}, nil
+}
+
+// NewRouter registers every route of c, with the protected ones behind
+// middlewares.Authentication.
+func NewRouter(c *controller.Controller, revocations *helpers.RevocationList, apiKeys repository.APIKeyRepository, logger *slog.Logger) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(middlewares.RequestID)
+	r.Use(middlewares.Logger(logger))
+	r.Use(middlewares.Metrics)
+	r.Use(middlewares.Recoverer)
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apperror.Write(w, r, apperror.NotFound("no route matches this path"))
+	})
+
+	doc := openapi.New()
+	r.Handle("/openapi.json", openapi.Handler(doc)).Methods("GET")
+	r.Handle("/docs", openapi.UIHandler("/openapi.json")).Methods("GET")
+	routes.HealthRoutes(r, c)
+
+	routes.UserRoutes(r, c)
+	routes.KeyRoutes(r, c)
+
+	enrol := r.NewRoute().Subrouter()
+	enrol.Use(middlewares.AuthenticationFor(revocations, helpers.AccessToken, helpers.MFAPendingToken))
+	routes.MFAEnrolmentRoutes(enrol, c)
+
+	api := r.PathPrefix("/").Subrouter()
+	api.Use(middlewares.Authentication(revocations, apiKeys))
+
+	routes.UserProtectedRoutes(api, c)
+	routes.FoodRoutes(api, c)
+	routes.MenuRoutes(api, c)
+	routes.OrderRoutes(api, c)
+	routes.OrderItemRoutes(api, c)
+	routes.TableRoutes(api, c)
+	routes.InvoiceRoutes(api, c)
+	routes.APIKeyRoutes(api, c)
+	// The metrics include revenue, so scrapers need a manager's token or an
+	// API key with that role.
+	api.Handle("/metrics", middlewares.RequireRole(model.RoleManager)(metrics.Handler())).Methods("GET")
+
+	// A route missing from the document is a bug, but not one worth
+	// refusing to start over.
+	undocumented, err := doc.Undocumented(r)
+	if err != nil {
+		logger.Warn("could not check the OpenAPI document", "error", err)
+	}
+	for _, route := range undocumented {
+		logger.Warn("route is missing from the OpenAPI document", "route", route)
+	}
+
+	return r
+}
+
+// Run serves the router on the configured port until ctx is cancelled, then
+// drains in-flight requests within Config.ShutdownTimeout and disconnects
+// the Mongo client. It returns nil after a clean shutdown.
+func (a *App) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:         ":" + a.Config.Port,
+		Handler:      a.Router,
+		ReadTimeout:  a.Config.ReadTimeout,
+		WriteTimeout: a.Config.WriteTimeout,
+		IdleTimeout:  a.Config.IdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		a.disconnect()
+		return err
+	case <-ctx.Done():
+	}
+
+	a.Logger.Info("shutting down, draining in-flight requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		err = fmt.Errorf("shutting down http server: %w", err)
+	}
+	if dErr := a.disconnectWithin(shutdownCtx); dErr != nil && err == nil {
+		err = dErr
+	}
+	return err
+}
+
+func (a *App) disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), a.Config.ShutdownTimeout)
+	defer cancel()
+	if err := a.disconnectWithin(ctx); err != nil {
+		a.Logger.Error("disconnecting", "error", err)
+	}
+}
+
+func (a *App) disconnectWithin(ctx context.Context) error {
+	if a.Client == nil {
+		return nil
+	}
+	if err := a.Client.Disconnect(ctx); err != nil {
+		return fmt.Errorf("disconnecting from mongo: %w", err)
+	}
+	return nil
+}
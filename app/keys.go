@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/datmedevil17/restaurant-management/config"
+	"github.com/datmedevil17/restaurant-management/helpers"
+)
+
+// newKeySet loads the JWT keys described by cfg.
+func newKeySet(cfg config.Config) (*helpers.KeySet, error) {
+	var (
+		signing *helpers.SigningKey
+		err     error
+	)
+	switch {
+	case cfg.JWTKeyFile != "":
+		signing, err = helpers.LoadKeyFile(cfg.JWTKeyID, cfg.JWTKeyFile)
+	case cfg.JWTSecret != "":
+		signing, err = helpers.NewHMACKey(cfg.JWTKeyID, cfg.JWTSecret)
+	default:
+		return nil, errors.New("no JWT key configured, set JWT_KEY_FILE or SECRET_KEY")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading JWT signing key: %w", err)
+	}
+
+	var verifyOnly []*helpers.SigningKey
+	for _, file := range cfg.JWTVerifyKeyFiles {
+		key, err := helpers.LoadKeyFile(file.ID, file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWT verification key: %w", err)
+		}
+		// Only the public half of a retired key is needed.
+		key.Private = nil
+		verifyOnly = append(verifyOnly, key)
+	}
+	for _, secret := range cfg.JWTVerifySecrets {
+		key, err := helpers.NewHMACKey(secret.ID, secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWT verification secret %q: %w", secret.ID, err)
+		}
+		// A retired secret must not sign anything new.
+		key.Private = nil
+		verifyOnly = append(verifyOnly, key)
+	}
+
+	return helpers.NewKeySet(signing, verifyOnly...)
+}
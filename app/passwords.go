@@ -0,0 +1,37 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/datmedevil17/restaurant-management/config"
+	"github.com/datmedevil17/restaurant-management/helpers"
+)
+
+// newPasswords builds the password hasher and policy described by cfg.
+func newPasswords(cfg config.Config) (helpers.PasswordHasher, *helpers.PasswordPolicy, error) {
+	hasher, err := helpers.NewPasswordHasher(cfg.PasswordHasher, cfg.BcryptCost, helpers.Argon2Params{
+		Memory:  cfg.Argon2Memory,
+		Time:    cfg.Argon2Time,
+		Threads: cfg.Argon2Threads,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuring password hashing: %w", err)
+	}
+
+	policy := &helpers.PasswordPolicy{
+		MinLength: cfg.PasswordMinLength,
+		MaxLength: cfg.PasswordMaxLength,
+	}
+	// Longer passwords would be cut short by the hasher without the user
+	// knowing.
+	if limit := hasher.MaxLength(); limit > 0 && (policy.MaxLength == 0 || policy.MaxLength > limit) {
+		policy.MaxLength = limit
+	}
+	if cfg.BreachedPasswordsFile != "" {
+		policy.Breached, err = helpers.LoadBreachedPasswords(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading breached passwords: %w", err)
+		}
+	}
+	return hasher, policy, nil
+}
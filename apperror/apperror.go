@@ -0,0 +1,167 @@
+// Package apperror defines the errors handlers report and writes them as
+// RFC 7807 problem details.
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/datmedevil17/restaurant-management/logging"
+)
+
+// Kind classifies an Error and decides its HTTP status.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindNotFound
+	KindValidation
+	KindConflict
+	KindUnauthorized
+	KindForbidden
+	KindTooManyRequests
+	KindInvalid
+	KindPreconditionFailed
+)
+
+var statuses = map[Kind]int{
+	KindInternal:           http.StatusInternalServerError,
+	KindNotFound:           http.StatusNotFound,
+	KindValidation:         http.StatusBadRequest,
+	KindConflict:           http.StatusConflict,
+	KindUnauthorized:       http.StatusUnauthorized,
+	KindForbidden:          http.StatusForbidden,
+	KindTooManyRequests:    http.StatusTooManyRequests,
+	KindInvalid:            http.StatusUnprocessableEntity,
+	KindPreconditionFailed: http.StatusPreconditionFailed,
+}
+
+// Error is an error meant for the client. Detail and Fields are shown to the
+// client; Err is the underlying cause, which is only logged.
+type Error struct {
+	Kind   Kind
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError describes one field of a request body that failed validation:
+// its path in the body, the rule it broke and a message for people.
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status is the HTTP status code e is written with.
+func (e *Error) Status() int {
+	return statuses[e.Kind]
+}
+
+func NotFound(detail string) *Error {
+	return &Error{Kind: KindNotFound, Detail: detail}
+}
+
+func Validation(detail string) *Error {
+	return &Error{Kind: KindValidation, Detail: detail}
+}
+
+func Conflict(detail string) *Error {
+	return &Error{Kind: KindConflict, Detail: detail}
+}
+
+func PreconditionFailed(detail string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Detail: detail}
+}
+
+func Unauthorized(detail string) *Error {
+	return &Error{Kind: KindUnauthorized, Detail: detail}
+}
+
+func Forbidden(detail string) *Error {
+	return &Error{Kind: KindForbidden, Detail: detail}
+}
+
+func TooManyRequests(detail string) *Error {
+	return &Error{Kind: KindTooManyRequests, Detail: detail}
+}
+
+// Invalid reports a well-formed request body whose fields break the rules
+// of the resource.
+func Invalid(fields []FieldError) *Error {
+	return &Error{Kind: KindInvalid, Detail: "the request body failed validation", Fields: fields}
+}
+
+// Internal reports a failure of the server itself; err is logged but never
+// sent to the client.
+func Internal(detail string, err error) *Error {
+	return &Error{Kind: KindInternal, Detail: detail, Err: err}
+}
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Status     int          `json:"status"`
+	Detail     string       `json:"detail,omitempty"`
+	Instance   string       `json:"instance,omitempty"`
+	Request_id string       `json:"request_id"`
+	Errors     []FieldError `json:"errors,omitempty"`
+}
+
+// Write sends err to the client as application/problem+json. Errors that are
+// not an *Error are treated as internal.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var appErr *Error
+	if !errors.As(err, &appErr) {
+		appErr = Internal("internal server error", err)
+	}
+
+	requestID := RequestID(w, r)
+	if appErr.Kind == KindInternal {
+		// The request logger already carries the request id.
+		logging.FromContext(r.Context()).Error("internal error",
+			"method", r.Method, "path", r.URL.Path, "error", appErr)
+	}
+
+	status := appErr.Status()
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     appErr.Detail,
+		Instance:   r.URL.Path,
+		Request_id: requestID,
+		Errors:     appErr.Fields,
+	})
+}
+
+// RequestID returns the id of the request: the one middlewares.RequestID
+// settled on, else the X-Request-ID already set on the response, else the one
+// the client sent or a new one. The id is echoed in the X-Request-ID response
+// header.
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := logging.RequestID(r.Context()); id != "" {
+		return id
+	}
+	if id := w.Header().Get("X-Request-ID"); id != "" {
+		return id
+	}
+	id := logging.RequestIDFrom(r.Header.Get("X-Request-ID"))
+	w.Header().Set("X-Request-ID", id)
+	return id
+}
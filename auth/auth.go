@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/datmedevil17/restaurant-management/helpers"
+	model "github.com/datmedevil17/restaurant-management/models"
+)
+
+// Kinds of Principal.
+const (
+	UserPrincipal   = "user"
+	APIKeyPrincipal = "api_key"
+)
+
+// Principal is the authenticated caller of a request: either a user holding
+// a JWT or a machine client presenting an API key. Role is what role checks
+// are made against in both cases.
+type Principal struct {
+	Kind string
+	// Uid is the id of the user, empty for API keys.
+	Uid   string
+	Email string
+	Role  string
+	// Claims are those of the user's token, nil for API keys.
+	Claims *helpers.SignedDetails
+	// APIKey is the key presented, nil for users.
+	APIKey *model.APIKey
+}
+
+// IsUser reports whether p is a signed-in user rather than an API key.
+func (p *Principal) IsUser() bool {
+	return p.Kind == UserPrincipal
+}
+
+// NewUserPrincipal returns the principal of a user authenticated by claims.
+func NewUserPrincipal(claims *helpers.SignedDetails) *Principal {
+	return &Principal{
+		Kind:   UserPrincipal,
+		Uid:    claims.Uid,
+		Email:  claims.Email,
+		Role:   claims.Role,
+		Claims: claims,
+	}
+}
+
+// NewAPIKeyPrincipal returns the principal of a client authenticated by key.
+func NewAPIKeyPrincipal(key *model.APIKey) *Principal {
+	p := &Principal{Kind: APIKeyPrincipal, APIKey: key}
+	if key.Role != nil {
+		p.Role = *key.Role
+	}
+	return p
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated caller.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// FromContext returns the caller stored by middlewares.Authentication, if the
+// request went through it.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(contextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,89 @@
+// Command cleanup finds the documents that updates used to create when they
+// were sent to an id that did not exist. Such a document holds little more
+// than its key and updated_at, and never got a created_at. cleanup lists
+// them; with -delete it also removes them. Run it before the server builds
+// its unique key indexes on a database that old updates wrote to. It needs
+// only MONGO_URL and MONGO_DATABASE.
+//
+//	go run ./cmd/cleanup [-delete]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/datmedevil17/restaurant-management/config"
+	database "github.com/datmedevil17/restaurant-management/databases"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var orphaned = bson.D{{Key: "created_at", Value: bson.D{{Key: "$exists", Value: false}}}}
+
+func main() {
+	remove := flag.Bool("delete", false, "delete the orphaned documents instead of only listing them")
+	flag.Parse()
+
+	cfg, err := config.LoadMongo()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	client, err := database.Connect(ctx, cfg.MongoURI, cfg.ConnectTimeout, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Disconnect(context.Background())
+	db := client.Database(cfg.Database)
+
+	total := 0
+	// The collections whose updates upserted are the ones the server gives
+	// unique key indexes.
+	for _, u := range repository.UniqueKeys {
+		n, err := report(ctx, db.Collection(u.Collection), u.Key)
+		if err != nil {
+			log.Fatalf("%s: %v", u.Collection, err)
+		}
+		total += n
+		if n == 0 || !*remove {
+			continue
+		}
+		result, err := db.Collection(u.Collection).DeleteMany(ctx, orphaned)
+		if err != nil {
+			log.Fatalf("%s: %v", u.Collection, err)
+		}
+		fmt.Printf("%s: deleted %d\n", u.Collection, result.DeletedCount)
+	}
+
+	fmt.Printf("%d orphaned documents\n", total)
+	if total > 0 && !*remove {
+		fmt.Println("run again with -delete to remove them")
+	}
+}
+
+// report prints every orphaned document of collection and returns how many
+// there are.
+func report(ctx context.Context, collection *mongo.Collection, key string) (int, error) {
+	opt := options.Find().SetProjection(bson.D{{Key: key, Value: 1}, {Key: "updated_at", Value: 1}})
+	cursor, err := collection.Find(ctx, orphaned, opt)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	n := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return n, err
+		}
+		fmt.Printf("%s: _id=%v %s=%v updated_at=%v\n", collection.Name(), doc["_id"], key, doc[key], doc["updated_at"])
+		n++
+	}
+	return n, cursor.Err()
+}
@@ -0,0 +1,376 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config is everything the server needs to start. Values come from the
+// environment, optionally seeded from a .env file.
+type Config struct {
+	MongoURI string
+	Database string
+	Port     string
+	// Environment is "development" or "production". Production logs are
+	// JSON, development logs plain text; LogLevel is debug, info, warn or
+	// error.
+	Environment string
+	LogLevel    string
+	// Tokens are signed with the PEM key at JWTKeyFile (RS256 or EdDSA) if
+	// set, otherwise with JWTSecret (HS256). JWTVerifyKeyFiles are PEM keys
+	// and JWTVerifySecrets HMAC secrets that are still accepted, e.g. the key
+	// being rotated out.
+	JWTSecret         string
+	JWTKeyID          string
+	JWTKeyFile        string
+	JWTVerifyKeyFiles []KeyFile
+	JWTVerifySecrets  []Secret
+	ConnectTimeout    time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout bounds how long in-flight requests may take to drain
+	// once the server has been asked to stop.
+	ShutdownTimeout time.Duration
+	// RevocationCacheTTL is how long token revocation lookups are cached in
+	// memory before MongoDB is asked again.
+	RevocationCacheTTL time.Duration
+	// ReadinessTimeout bounds each dependency check behind /readyz.
+	ReadinessTimeout time.Duration
+	// Failed logins back off exponentially from LoginBackoff; after
+	// LoginMaxFailures for an account, or LoginIPMaxFailures from one
+	// address, logins are refused for LoginLockout. Password reset and
+	// verification mails are limited the same way, counted separately.
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginBackoff       time.Duration
+	LoginLockout       time.Duration
+	// TrustedProxies are the reverse proxies, as addresses or CIDR ranges,
+	// whose X-Forwarded-For is believed when telling clients apart.
+	// Without them every client behind a proxy shares the proxy's address.
+	TrustedProxies []netip.Prefix
+	// NotifyFile is where user notifications such as password reset codes
+	// are appended. When empty they are written to the log, which is only
+	// allowed in development.
+	NotifyFile string
+	// PasswordHasher is "bcrypt" or "argon2id". Stored hashes made with
+	// another scheme or other costs are replaced at the next login.
+	PasswordHasher string
+	BcryptCost     int
+	// Argon2Memory is in KiB.
+	Argon2Memory  int
+	Argon2Time    int
+	Argon2Threads int
+	// New passwords must be PasswordMinLength characters to PasswordMaxLength
+	// bytes long and must not appear in BreachedPasswordsFile, a list with
+	// one password per line. PasswordMaxLength is capped at, and when 0 is,
+	// the most the hasher looks at: 72 bytes for bcrypt, unlimited for
+	// argon2id.
+	PasswordMinLength     int
+	PasswordMaxLength     int
+	BreachedPasswordsFile string
+	// Users holding one of MFARequiredRoles must enrol a TOTP authenticator
+	// before they can finish logging in. MFAIssuer names the service in
+	// authenticator apps; MFAPendingTTL is how long a user has to enter
+	// their code after giving the right password.
+	MFARequiredRoles []string
+	MFAIssuer        string
+	MFAPendingTTL    time.Duration
+}
+
+// KeyFile is a PEM key on disk. An empty ID means the key's thumbprint.
+type KeyFile struct {
+	ID   string
+	Path string
+}
+
+// Secret is a retired HMAC secret and the key id tokens signed with it carry.
+type Secret struct {
+	ID    string
+	Value string
+}
+
+// Default returns the configuration used for any variable left unset.
+func Default() Config {
+	return Config{
+		Database:           "restaurant",
+		Port:               "8080",
+		Environment:        "development",
+		LogLevel:           "info",
+		ConnectTimeout:     10 * time.Second,
+		ReadTimeout:        15 * time.Second,
+		WriteTimeout:       15 * time.Second,
+		IdleTimeout:        60 * time.Second,
+		ShutdownTimeout:    20 * time.Second,
+		RevocationCacheTTL: 30 * time.Second,
+		ReadinessTimeout:   2 * time.Second,
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginBackoff:       time.Second,
+		LoginLockout:       15 * time.Minute,
+		PasswordHasher:     "bcrypt",
+		BcryptCost:         12,
+		Argon2Memory:       19 * 1024,
+		Argon2Time:         2,
+		Argon2Threads:      1,
+		PasswordMinLength:  8,
+		MFAIssuer:          "Restaurant",
+		MFAPendingTTL:      5 * time.Minute,
+	}
+}
+
+// Load reads the configuration from the environment. A .env file in the
+// working directory is loaded first if present; its absence is not an error.
+func Load() (Config, error) {
+	cfg, err := read()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadMongo reads the configuration like Load but checks only the MongoDB
+// settings, for tools that do nothing but work on the database.
+func LoadMongo() (Config, error) {
+	cfg, err := read()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.validateMongo(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func read() (Config, error) {
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Config{}, fmt.Errorf("loading .env: %w", err)
+	}
+
+	cfg := Default()
+	setString(&cfg.MongoURI, "MONGO_URL")
+	setString(&cfg.Database, "MONGO_DATABASE")
+	setString(&cfg.Port, "PORT")
+	setString(&cfg.Environment, "APP_ENV")
+	setString(&cfg.LogLevel, "LOG_LEVEL")
+	setString(&cfg.JWTSecret, "SECRET_KEY")
+	setString(&cfg.JWTKeyID, "JWT_KEY_ID")
+	setString(&cfg.JWTKeyFile, "JWT_KEY_FILE")
+	setString(&cfg.NotifyFile, "NOTIFY_FILE")
+	setString(&cfg.PasswordHasher, "PASSWORD_HASHER")
+	setString(&cfg.BreachedPasswordsFile, "BREACHED_PASSWORDS_FILE")
+	setString(&cfg.MFAIssuer, "MFA_ISSUER")
+	setList(&cfg.MFARequiredRoles, "MFA_REQUIRED_ROLES")
+	if err := setKeyFiles(&cfg.JWTVerifyKeyFiles, "JWT_VERIFY_KEY_FILES"); err != nil {
+		return Config{}, err
+	}
+	if err := setSecrets(&cfg.JWTVerifySecrets, "JWT_VERIFY_SECRETS"); err != nil {
+		return Config{}, err
+	}
+	if err := setPrefixes(&cfg.TrustedProxies, "TRUSTED_PROXIES"); err != nil {
+		return Config{}, err
+	}
+
+	durations := []struct {
+		dst *time.Duration
+		key string
+	}{
+		{&cfg.ConnectTimeout, "MONGO_CONNECT_TIMEOUT"},
+		{&cfg.ReadTimeout, "HTTP_READ_TIMEOUT"},
+		{&cfg.WriteTimeout, "HTTP_WRITE_TIMEOUT"},
+		{&cfg.IdleTimeout, "HTTP_IDLE_TIMEOUT"},
+		{&cfg.ShutdownTimeout, "HTTP_SHUTDOWN_TIMEOUT"},
+		{&cfg.RevocationCacheTTL, "REVOCATION_CACHE_TTL"},
+		{&cfg.ReadinessTimeout, "READINESS_TIMEOUT"},
+		{&cfg.LoginBackoff, "LOGIN_BACKOFF"},
+		{&cfg.LoginLockout, "LOGIN_LOCKOUT"},
+		{&cfg.MFAPendingTTL, "MFA_PENDING_TTL"},
+	}
+	for _, d := range durations {
+		if err := setDuration(d.dst, d.key); err != nil {
+			return Config{}, err
+		}
+	}
+
+	ints := []struct {
+		dst *int
+		key string
+	}{
+		{&cfg.LoginMaxFailures, "LOGIN_MAX_FAILURES"},
+		{&cfg.LoginIPMaxFailures, "LOGIN_IP_MAX_FAILURES"},
+		{&cfg.BcryptCost, "BCRYPT_COST"},
+		{&cfg.Argon2Memory, "ARGON2_MEMORY"},
+		{&cfg.Argon2Time, "ARGON2_TIME"},
+		{&cfg.Argon2Threads, "ARGON2_THREADS"},
+		{&cfg.PasswordMinLength, "PASSWORD_MIN_LENGTH"},
+		{&cfg.PasswordMaxLength, "PASSWORD_MAX_LENGTH"},
+	}
+	for _, n := range ints {
+		if err := setInt(n.dst, n.key); err != nil {
+			return Config{}, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// Validate reports the first setting that would keep the server from starting.
+func (c Config) Validate() error {
+	if err := c.validateMongo(); err != nil {
+		return err
+	}
+	if c.Port == "" {
+		return errors.New("config: PORT is empty")
+	}
+	if c.Environment != "development" && c.Environment != "production" {
+		return fmt.Errorf("config: APP_ENV must be development or production, not %q", c.Environment)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return fmt.Errorf("config: LOG_LEVEL must be debug, info, warn or error, not %q", c.LogLevel)
+	}
+	if c.JWTSecret == "" && c.JWTKeyFile == "" {
+		return errors.New("config: no JWT key configured, set JWT_KEY_FILE or SECRET_KEY")
+	}
+	if c.NotifyFile == "" && c.Environment == "production" {
+		return errors.New("config: NOTIFY_FILE must be set in production, or reset and verification codes would be written to the log")
+	}
+	return nil
+}
+
+func (c Config) validateMongo() error {
+	if c.MongoURI == "" {
+		return errors.New("config: MONGO_URL is not set")
+	}
+	if c.Database == "" {
+		return errors.New("config: MONGO_DATABASE is empty")
+	}
+	return nil
+}
+
+func setString(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+// setList parses a comma separated list, dropping empty entries.
+func setList(dst *[]string, key string) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+	var list []string
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	*dst = list
+}
+
+func setDuration(dst *time.Duration, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = d
+	return nil
+}
+
+func setInt(dst *int, key string) error {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("config: %s: %w", key, err)
+	}
+	*dst = n
+	return nil
+}
+
+// setKeyFiles parses a comma separated list of paths, each optionally
+// prefixed with "kid=".
+func setKeyFiles(dst *[]KeyFile, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var files []KeyFile
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		file := KeyFile{Path: entry}
+		if kid, path, ok := strings.Cut(entry, "="); ok {
+			file = KeyFile{ID: kid, Path: path}
+		}
+		if file.Path == "" {
+			return fmt.Errorf("config: %s: empty path in %q", key, entry)
+		}
+		files = append(files, file)
+	}
+	*dst = files
+	return nil
+}
+
+// setSecrets parses a comma separated list of "kid=secret" entries. The kid
+// is required: it is how tokens find the secret they were signed with.
+func setSecrets(dst *[]Secret, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var secrets []Secret
+	for _, entry := range strings.Split(v, ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || secret == "" {
+			return fmt.Errorf("config: %s: entries must look like kid=secret", key)
+		}
+		secrets = append(secrets, Secret{ID: kid, Value: secret})
+	}
+	*dst = secrets
+	return nil
+}
+
+// setPrefixes parses a comma separated list of CIDR ranges and addresses; an
+// address stands for itself alone.
+func setPrefixes(dst *[]netip.Prefix, key string) error {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(v, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return fmt.Errorf("config: %s: %w", key, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	*dst = prefixes
+	return nil
+}
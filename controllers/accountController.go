@@ -0,0 +1,311 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	"github.com/datmedevil17/restaurant-management/logging"
+	model "github.com/datmedevil17/restaurant-management/models"
+	notifier "github.com/datmedevil17/restaurant-management/notifiers"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 24 * time.Hour
+)
+
+// PasswordForgot is the body of POST /users/password/forgot.
+type PasswordForgot struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// PasswordReset is the body of POST /users/password/reset.
+type PasswordReset struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// EmailVerification is the body of POST /users/email/verify.
+type EmailVerification struct {
+	Token string `json:"token"`
+}
+
+// issueUserToken stores a new single-use token for user and returns the code
+// to send them.
+func (c *Controller) issueUserToken(ctx context.Context, user *model.User, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := helpers.NewUserToken()
+	if err != nil {
+		return "", err
+	}
+
+	var userToken model.UserToken
+	userToken.ID = primitive.NewObjectID()
+	userToken.Token_hash = hash
+	userToken.User_id = user.User_id
+	userToken.Purpose = purpose
+	userToken.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	userToken.Expires_at = userToken.Created_at.Add(ttl)
+
+	if _, err := c.repos.UserTokens.Create(ctx, userToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// throttleMail answers 429 and returns false when too many codes have lately
+// been mailed to email or asked for from the client; otherwise it counts this
+// one against both and returns true.
+func (c *Controller) throttleMail(ctx context.Context, w http.ResponseWriter, r *http.Request, email string) bool {
+	ip := c.clientIP(r)
+	retryAfter, err := c.mails.Check(ctx, email, ip)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while checking sent mail", err))
+		return false
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		apperror.Write(w, r, apperror.TooManyRequests("too many codes have been sent, try again later"))
+		return false
+	}
+	if err := c.mails.Fail(ctx, email, ip); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while recording sent mail", err))
+		return false
+	}
+	return true
+}
+
+func (c *Controller) sendPasswordReset(ctx context.Context, email string) error {
+	foundUser, err := c.repos.Users.GetByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := c.issueUserToken(ctx, foundUser, model.PasswordResetToken, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return c.notifier.Notify(ctx, notifier.Message{
+		To:      *foundUser.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use this code to reset your password: %s\nIt expires in one hour. If you did not ask for it, ignore this message.", token),
+	})
+}
+
+func (c *Controller) sendEmailVerification(ctx context.Context, user *model.User) error {
+	token, err := c.issueUserToken(ctx, user, model.EmailVerificationToken, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return c.notifier.Notify(ctx, notifier.Message{
+		To:      *user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Use this code to verify your email address: %s\nIt expires in 24 hours.", token),
+	})
+}
+
+// ForgotPassword sends a password reset code to the given email. It answers
+// the same, and as fast, whether or not the email is registered: the lookup
+// and the mail happen after the response.
+func (c *Controller) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var body PasswordForgot
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(body); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	if !c.throttleMail(ctx, w, r, body.Email) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 100*time.Second)
+		defer cancel()
+		if err := c.sendPasswordReset(ctx, body.Email); err != nil {
+			logging.FromContext(ctx).Warn("sending password reset", "error", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "if the email is registered, a reset code has been sent to it"})
+}
+
+// ResetPassword sets a new password using a code from ForgotPassword. Every
+// existing session of the user is revoked.
+func (c *Controller) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var body PasswordReset
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(body); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	tokenHash := helpers.HashUserToken(body.Token)
+
+	// The new password is checked against the account before the code is
+	// used up, so a rejected password does not cost the user their code.
+	userToken, err := c.repos.UserTokens.Get(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.Validation("reset token is invalid or has expired"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while checking the reset token", err))
+		return
+	}
+
+	foundUser, err := c.repos.Users.Get(ctx, userToken.User_id)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+
+	if err := c.checkPasswordPolicy(body.Password, stringValue(foundUser.Email)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	if _, err := c.repos.UserTokens.Consume(ctx, tokenHash, model.PasswordResetToken); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.Validation("reset token is invalid or has expired"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while checking the reset token", err))
+		return
+	}
+
+	password, err := c.passwords.Hash(body.Password)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error hashing password", err))
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "password", Value: password},
+		{Key: "token", Value: ""},
+		{Key: "refresh_token", Value: ""},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, foundUser.User_id, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "password update failed"))
+		return
+	}
+
+	if err := c.revocations.RevokeUser(ctx, foundUser.User_id); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking sessions", err))
+		return
+	}
+	if foundUser.Email != nil {
+		if err := c.logins.Unlock(ctx, *foundUser.Email); err != nil {
+			logging.FromContext(r.Context()).Warn("unlocking after password reset", "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
+
+// VerifyEmail marks the email of a user as verified using a code sent at
+// signup or by ResendEmailVerification.
+func (c *Controller) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var body EmailVerification
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+		apperror.Write(w, r, apperror.Validation("token is required"))
+		return
+	}
+
+	userToken, err := c.repos.UserTokens.Consume(ctx, helpers.HashUserToken(body.Token), model.EmailVerificationToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.Validation("verification token is invalid or has expired"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while checking the verification token", err))
+		return
+	}
+
+	if _, err := c.repos.Users.Get(ctx, userToken.User_id); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "email_verified", Value: true},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, userToken.User_id, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "email verification failed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified successfully"})
+}
+
+// ResendEmailVerification sends the authenticated user a new verification
+// code.
+func (c *Controller) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	claims := currentUserClaims(w, r)
+	if claims == nil {
+		return
+	}
+
+	foundUser, err := c.repos.Users.Get(ctx, claims.Uid)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+	if foundUser.Email_verified {
+		apperror.Write(w, r, apperror.Conflict("email is already verified"))
+		return
+	}
+	if !c.throttleMail(ctx, w, r, *foundUser.Email) {
+		return
+	}
+
+	if err := c.sendEmailVerification(ctx, foundUser); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while sending the verification code", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "a verification code has been sent"})
+}
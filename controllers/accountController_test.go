@@ -0,0 +1,23 @@
+package controller_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPasswordResetMailIsThrottled(t *testing.T) {
+	h, _ := newServer(t)
+
+	rec := call(h, "POST", "/users/password/forgot", `{"email":"nobody@example.com"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("first reset: got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = call(h, "POST", "/users/password/forgot", `{"email":"nobody@example.com"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second reset: got %d, want 429: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without a Retry-After header")
+	}
+}
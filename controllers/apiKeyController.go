@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/auth"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	model "github.com/datmedevil17/restaurant-management/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyCreated is the answer to CreateAPIKey, the only time the key itself
+// is shown.
+type APIKeyCreated struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+func (c *Controller) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	query, err := parseListQuery(r, map[string]string{"role": "role"})
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	keys, err := c.repos.APIKeys.ListPage(ctx, query)
+	if err != nil {
+		apperror.Write(w, r, listError(err, "api keys"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newListResponse(keys))
+}
+
+func (c *Controller) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	key, err := c.findAPIKey(ctx, mux.Vars(r)["api_key_id"])
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(key)
+}
+
+// CreateAPIKey issues a key for a machine client. The key is returned once;
+// only its hash and prefix are stored.
+func (c *Controller) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var apiKey model.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&apiKey); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(apiKey); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if apiKey.Expires_at != nil && !apiKey.Expires_at.After(time.Now()) {
+		apperror.Write(w, r, apperror.Validation("expires_at must be in the future"))
+		return
+	}
+
+	key, prefix, hash, err := helpers.NewAPIKey()
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while generating the api key", err))
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	apiKey.Prefix = prefix
+	apiKey.Key_hash = hash
+	apiKey.Last_used_at = nil
+	apiKey.Revoked_at = nil
+	apiKey.Created_by = principal.Uid
+	apiKey.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	apiKey.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	apiKey.ID = primitive.NewObjectID()
+	apiKey.Api_key_id = apiKey.ID.Hex()
+
+	if _, err := c.repos.APIKeys.Create(ctx, apiKey); err != nil {
+		apperror.Write(w, r, apperror.Internal("api key was not created", err))
+		return
+	}
+
+	w.Header().Set("Location", "/api-keys/"+apiKey.Api_key_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(APIKeyCreated{APIKey: apiKey, Key: key})
+}
+
+// RevokeAPIKey stops a key from being accepted. The record is kept so the
+// key's history can still be looked up.
+func (c *Controller) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	apiKeyId := mux.Vars(r)["api_key_id"]
+	key, err := c.findAPIKey(ctx, apiKeyId)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if key.Revoked_at != nil {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"message": "API key was already revoked"})
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "revoked_at", Value: updated_at},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.APIKeys.Update(ctx, apiKeyId, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "api key", "api key revocation failed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked successfully"})
+}
+
+// findAPIKey loads apiKeyId, failing with a 404 if there is no such key.
+func (c *Controller) findAPIKey(ctx context.Context, apiKeyId string) (*model.APIKey, error) {
+	key, err := c.repos.APIKeys.Get(ctx, apiKeyId)
+	if err != nil {
+		return nil, lookupError(err, "api key")
+	}
+	return key, nil
+}
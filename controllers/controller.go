@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"net/netip"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	notifier "github.com/datmedevil17/restaurant-management/notifiers"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+)
+
+// Controller holds the repositories the HTTP handlers read from and write to.
+type Controller struct {
+	repos          *repository.Repositories
+	revocations    *helpers.RevocationList
+	logins         *helpers.LoginThrottle
+	mails          *helpers.LoginThrottle
+	notifier       notifier.Notifier
+	passwords      helpers.PasswordHasher
+	passwordPolicy *helpers.PasswordPolicy
+	mfa            MFASettings
+	readiness      Readiness
+	trustedProxies []netip.Prefix
+	// dummyPasswordHash is verified against when a login names an unknown
+	// email, so that such logins take as long as ones with a wrong password.
+	dummyPasswordHash string
+}
+
+// Services are what the handlers need besides the repositories.
+type Services struct {
+	Revocations    *helpers.RevocationList
+	Logins         *helpers.LoginThrottle
+	Mails          *helpers.LoginThrottle
+	Notifier       notifier.Notifier
+	Passwords      helpers.PasswordHasher
+	PasswordPolicy *helpers.PasswordPolicy
+	MFA            MFASettings
+	Readiness      Readiness
+	// TrustedProxies are the proxies whose X-Forwarded-For names the client.
+	TrustedProxies []netip.Prefix
+}
+
+func New(repos *repository.Repositories, services Services) *Controller {
+	dummyPasswordHash, err := services.Passwords.Hash("not a real password")
+	if err != nil {
+		dummyPasswordHash = fallbackPasswordHash
+	}
+
+	return &Controller{
+		repos:             repos,
+		revocations:       services.Revocations,
+		logins:            services.Logins,
+		mails:             services.Mails,
+		notifier:          services.Notifier,
+		passwords:         services.Passwords,
+		passwordPolicy:    services.PasswordPolicy,
+		mfa:               services.MFA,
+		readiness:         services.Readiness,
+		trustedProxies:    services.TrustedProxies,
+		dummyPasswordHash: dummyPasswordHash,
+	}
+}
+
+// fallbackPasswordHash stands in for the dummy hash if hashing fails at startup.
+const fallbackPasswordHash = "$2a$14$/TjCTCl2GWJKnCAP9ZtNYepWjSo5lQ5Akvet8T5dSqKjDJde8CSAu"
+
+// lookupError is the error to report when fetching the what with a given id
+// fails: a 404 if it does not exist, else a 500.
+func lookupError(err error, what string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound(what + " with this ID not found")
+	}
+	return apperror.Internal("error occured while fetching the "+what, err)
+}
+
+// updateError reports a failed update of what, which is not found if it was
+// deleted since it was looked up.
+func updateError(err error, what string, detail string) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return apperror.NotFound(what + " with this ID not found")
+	}
+	return apperror.Internal(detail, err)
+}
@@ -0,0 +1,88 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// failingOrderItems is an order item repository whose inserts fail.
+type failingOrderItems struct {
+	repository.OrderItemRepository
+}
+
+func (failingOrderItems) CreateMany(ctx context.Context, items []model.OrderItem) (*mongo.InsertManyResult, error) {
+	return nil, errors.New("insert failed")
+}
+
+// These requests used to end the process with log.Fatal; each must now be
+// answered with a problem document and leave the server running.
+func TestFailurePathsAnswerWithErrors(t *testing.T) {
+	h, repos := newServer(t)
+	_, token := signUp(t, h, "ada@example.com", "1")
+	auth := bearer(token)
+
+	rec := call(h, "POST", "/menus", `{"name":"Lunch","category":"main"}`, auth...)
+	menuId, _ := decode(t, rec)["menu_id"].(string)
+	rec = call(h, "POST", "/foods", `{"name":"Soup","price":3,"food_image":"soup.png","menu_id":"`+menuId+`"}`, auth...)
+	foodId, _ := decode(t, rec)["food_id"].(string)
+	rec = call(h, "POST", "/tables", `{"number_of_guests":2,"table_number":1}`, auth...)
+	tableId, _ := decode(t, rec)["table_id"].(string)
+	if menuId == "" || foodId == "" || tableId == "" {
+		t.Fatal("could not set up a menu, food and table")
+	}
+	repos.OrderItems = failingOrderItems{repos.OrderItems}
+
+	missing := primitive.NewObjectID().Hex()
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", "/orders?cursor=junk", "", http.StatusBadRequest},
+		{"GET", "/tables?cursor=junk", "", http.StatusBadRequest},
+		{"GET", "/invoices?cursor=junk", "", http.StatusBadRequest},
+		{"GET", "/invoices/" + missing, "", http.StatusNotFound},
+		{"GET", "/menus/not-hex", "", http.StatusNotFound},
+		{"DELETE", "/menus/not-hex", "", http.StatusNotFound},
+		{"DELETE", "/menus/" + missing, "", http.StatusNotFound},
+		{"PATCH", "/menus/" + menuId, "{}", http.StatusUnprocessableEntity},
+		{"GET", "/foods/not-hex", "", http.StatusNotFound},
+		{"DELETE", "/foods/not-hex", "", http.StatusNotFound},
+		{"DELETE", "/foods/" + missing, "", http.StatusNotFound},
+		{"POST", "/order-items", `{"table_id":"` + missing + `","order_items":[{"quantity":"M","unit_price":3,"food_id":"` + foodId + `"}]}`, http.StatusNotFound},
+		{"POST", "/order-items", `{"table_id":"` + tableId + `","order_items":[{"quantity":"M","unit_price":3,"food_id":"` + foodId + `"}]}`, http.StatusInternalServerError},
+	} {
+		rec := call(h, tc.method, tc.path, tc.body, auth...)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: got %d, want %d: %s", tc.method, tc.path, rec.Code, tc.status, rec.Body)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s %s: Content-Type %q, want a problem document", tc.method, tc.path, ct)
+		}
+		if got := decode(t, rec)["status"]; got != float64(tc.status) {
+			t.Errorf("%s %s: problem status %v", tc.method, tc.path, got)
+		}
+	}
+
+	// The order made for the items that failed is removed again.
+	orders, err := repos.Orders.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("%d orders left behind by the failed order items", len(orders))
+	}
+
+	if rec := call(h, "GET", "/menus/"+menuId, "", auth...); rec.Code != http.StatusOK {
+		t.Errorf("server stopped answering after the failures: got %d", rec.Code)
+	}
+}
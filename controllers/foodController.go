@@ -3,83 +3,66 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/apperror"
 	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
-
-func getFood(foodId string) (*model.Food, error) {
-	fId, err := primitive.ObjectIDFromHex(foodId)
-	if err != nil {
-		return nil, err
-	}
+// FoodUpdate is the body of PATCH /foods/{food_id}; absent fields are left
+// unchanged.
+type FoodUpdate struct {
+	Name       *string  `json:"name" validate:"omitnil,min=2,max=100"`
+	Price      *float64 `json:"price" validate:"omitnil,gt=0"`
+	Food_image *string  `json:"food_image" validate:"omitnil,min=1"`
+	Menu_id    *string  `json:"menu_id" validate:"omitnil,min=1"`
+}
 
-	var food model.Food
-	filter := bson.M{"_id": fId}
-	err = foodCollection.FindOne(context.TODO(), filter).Decode(&food)
-	if err != nil {
-		return nil, err
-	}
-	return &food, err
+func (c *Controller) getFood(ctx context.Context, foodId string) (*model.Food, error) {
+	return c.repos.Foods.Get(ctx, foodId)
 }
 
-func getFoods() ([]model.Food, error) {
-	var foods []model.Food
-	cursor, err := foodCollection.Find(context.TODO(), bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(context.TODO())
-	for cursor.Next(context.TODO()) {
-		var food model.Food
-		err := cursor.Decode(&food)
-		if err != nil {
-			return nil, err
-		}
-		foods = append(foods, food)
-	}
-	return foods, nil
+func (c *Controller) getFoods(ctx context.Context, query repository.ListQuery) (*repository.Page[model.Food], error) {
+	return c.repos.Foods.ListPage(ctx, query)
 }
 
-func createFood(food model.Food) (*model.Food, error) {
+func (c *Controller) createFood(ctx context.Context, food model.Food) (*model.Food, error) {
 	food.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	result, err := foodCollection.InsertOne(context.TODO(), food)
+	food.ID = primitive.NewObjectID()
+	food.Food_id = food.ID.Hex()
+	_, err := c.repos.Foods.Create(ctx, food)
 	if err != nil {
 		return nil, err
 	}
-	food.ID = result.InsertedID.(primitive.ObjectID)
 	return &food, nil
 }
 
-func updateFood(foodId string, food model.Food) (*model.Food, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+func (c *Controller) updateFood(ctx context.Context, foodId string, food FoodUpdate) (*model.Food, error) {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Second)
 	defer cancel()
 
-	fId, err := primitive.ObjectIDFromHex(foodId)
-	if err != nil {
-		return nil, err
+	if _, err := primitive.ObjectIDFromHex(foodId); err != nil {
+		return nil, apperror.NotFound("Food not found")
 	}
 
 	var updateObj bson.D
 
-	if food.Name != "" {
+	if food.Name != nil {
 		updateObj = append(updateObj, bson.E{Key: "name", Value: food.Name})
 	}
 
-	if food.Price != 0 {
+	if food.Price != nil {
 		updateObj = append(updateObj, bson.E{Key: "price", Value: food.Price})
 	}
 
-	if food.Food_image != "" {
+	if food.Food_image != nil {
 		updateObj = append(updateObj, bson.E{Key: "food_image", Value: food.Food_image})
 	}
 
@@ -87,30 +70,23 @@ func updateFood(foodId string, food model.Food) (*model.Food, error) {
 		updateObj = append(updateObj, bson.E{Key: "menu_id", Value: food.Menu_id})
 	}
 
-	food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: food.Updated_at})
-
-	filter := bson.M{"_id": fId}
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
 
-	_, err = foodCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}})
+	updatedFood, err := c.repos.Foods.UpdateAndGet(ctx, foodId, updateObj)
 	if err != nil {
-		return nil, err
+		return nil, lookupError(err, "food")
 	}
-
-	food.ID = fId
-	return &food, nil
+	return updatedFood, nil
 }
 
-func deleteFood(foodId string) error {
-	fId, err := primitive.ObjectIDFromHex(foodId)
+func (c *Controller) deleteFood(ctx context.Context, foodId string) error {
+	result, err := c.repos.Foods.Delete(ctx, foodId)
 	if err != nil {
 		return err
 	}
-
-	filter := bson.M{"_id": fId}
-	_, err = foodCollection.DeleteOne(context.TODO(), filter)
-	if err != nil {
-		return err
+	if result.DeletedCount < 1 {
+		return repository.ErrNotFound
 	}
 	return nil
 }
@@ -121,88 +97,101 @@ func deleteFood(foodId string) error {
 //updateFood
 //deleteFood
 
-func GetFood(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetFood(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "GET")
 	params := mux.Vars(r)
 	foodId := params["food_id"]
-	food, err := getFood(foodId)
+	food, err := c.getFood(r.Context(), foodId)
 	if err != nil {
-		if err.Error() == "food not found" {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Food not found"})
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("Food not found"))
 			return
 		}
+		apperror.Write(w, r, apperror.Internal("Internal server error", err))
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(food)
 }
 
-func GetFoods(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetFoods(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "GET")
-	foods, err := getFoods()
+	query, err := parseListQuery(r, map[string]string{"menu_id": "menu_id"})
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	foods, err := c.getFoods(r.Context(), query)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		apperror.Write(w, r, listError(err, "foods"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(foods)
+	json.NewEncoder(w).Encode(newListResponse(foods))
 }
 
-func CreateFood(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) CreateFood(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "POST")
 	var food model.Food
 	err := json.NewDecoder(r.Body).Decode(&food)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Bad request"})
+		apperror.Write(w, r, apperror.Validation("Bad request"))
+		return
+	}
+	if err := validateBody(food); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
-	createdFood, err := createFood(food)
+	createdFood, err := c.createFood(r.Context(), food)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		apperror.Write(w, r, apperror.Internal("Internal server error", err))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Location", "/foods/"+createdFood.Food_id)
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(createdFood)
 }
 
-func DeleteFood(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DeleteFood(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "DELETE")
 	params := mux.Vars(r)
 	foodId := params["food_id"]
-	err := deleteFood(foodId)
+	err := c.deleteFood(r.Context(), foodId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("Food not found"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("Internal server error", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Food deleted successfully"})
 }
 
-func UpdateFood(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) UpdateFood(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "PUT")
 	params := mux.Vars(r)
 	foodId := params["food_id"]
-	var food model.Food
+	var food FoodUpdate
 	err := json.NewDecoder(r.Body).Decode(&food)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Bad request"})
+		apperror.Write(w, r, apperror.Validation("Bad request"))
+		return
+	}
+	if err := validateBody(food); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
-	updatedFood, err := updateFood(foodId, food)
+	updatedFood, err := c.updateFood(r.Context(), foodId, food)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		apperror.Write(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
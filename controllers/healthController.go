@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/logging"
+)
+
+// Readiness lists the dependencies ReadyCheck probes, each by name, and how
+// long each probe may take.
+type Readiness struct {
+	Checks  map[string]func(ctx context.Context) error
+	Timeout time.Duration
+}
+
+// DependencyStatus is the outcome of probing one dependency.
+type DependencyStatus struct {
+	Status      string `json:"status"`
+	Duration_ms int64  `json:"duration_ms"`
+}
+
+type ReadinessReport struct {
+	Status string                      `json:"status"`
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Git_sha    string `json:"git_sha"`
+	Build_time string `json:"build_time"`
+	Modified   bool   `json:"modified"`
+	Go_version string `json:"go_version"`
+}
+
+// HealthCheck is the liveness probe: it answers as long as the process can
+// serve requests at all.
+func (c *Controller) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyCheck is the readiness probe. It probes every dependency at once and
+// answers 503 if any of them fails; the failures themselves are only logged.
+func (c *Controller) ReadyCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	report := ReadinessReport{Status: "ok", Checks: map[string]DependencyStatus{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c.readiness.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), c.readiness.Timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			status := DependencyStatus{Status: "ok", Duration_ms: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = "unavailable"
+				logging.FromContext(r.Context()).Warn("readiness check failed", "dependency", name, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = status
+			if err != nil {
+				report.Status = "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetVersion reports the build of the running binary, as recorded by the Go
+// toolchain.
+func (c *Controller) GetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	info := BuildInfo{Version: "unknown"}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Version = build.Main.Version
+		info.Go_version = build.GoVersion
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Git_sha = setting.Value
+			case "vcs.time":
+				info.Build_time = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(info)
+}
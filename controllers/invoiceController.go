@@ -3,69 +3,69 @@ package controller
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/logging"
+	"github.com/datmedevil17/restaurant-management/metrics"
 	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type InvoiceViewFormat struct {
 	Invoice_id       string      `json:"invoice_id"`
 	Order_id         string      `json:"order_id"`
-	Payment_method   *string     `json:"payment_method" validate:"required,eq=CARD|eq=CASH|eq="`
-	Payment_status   *string     `json:"payment_status" validate:"required,eq=PENDING|eq=PAID|eq="`
+	Payment_method   *string     `json:"payment_method"`
+	Payment_status   *string     `json:"payment_status"`
 	Payment_due_date time.Time   `json:"payment_due_date"`
 	Payment_due      interface{} `json:"payment_due"`
 	Table_number     interface{} `json:"table_number"`
 	Order_details    interface{} `json:"order_details"`
 }
 
-var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
+// InvoiceUpdate is the body of PUT and PATCH /invoices/{invoice_id}; absent
+// fields are left unchanged.
+type InvoiceUpdate struct {
+	Payment_method *string `json:"payment_method" validate:"omitnil,oneof=CARD CASH"`
+	Payment_status *string `json:"payment_status" validate:"omitnil,oneof=PENDING PAID"`
+}
 
-func GetInvoices(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetInvoices(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var invoices []model.Invoice
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := invoiceCollection.Find(context.TODO(), bson.M{})
+	query, err := parseListQuery(r, map[string]string{"order_id": "order_id", "status": "payment_status", "payment_method": "payment_method"})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing invoice items"})
+		apperror.Write(w, r, err)
 		return
 	}
-	defer result.Close(ctx)
-	for result.Next(ctx) {
-		var invoice model.Invoice
-		if err := result.Decode(&invoice); err != nil {
-			log.Fatal(err)
-		}
-		invoices = append(invoices, invoice)
+
+	invoices, err := c.repos.Invoices.ListPage(ctx, query)
+	if err != nil {
+		apperror.Write(w, r, listError(err, "invoices"))
+		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(invoices)
+	json.NewEncoder(w).Encode(newListResponse(invoices))
 }
 
-func GetInvoice(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetInvoice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	invoiceId := params["invoice_id"]
-	var invoice model.Invoice
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	err := invoiceCollection.FindOne(ctx, bson.M{"invoice_id": invoiceId}).Decode(&invoice)
+	invoice, err := c.repos.Invoices.Get(ctx, invoiceId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing invoice item"})
+		apperror.Write(w, r, lookupError(err, "invoice"))
 		return
 	}
 
@@ -77,73 +77,55 @@ func GetInvoice(w http.ResponseWriter, r *http.Request) {
 	invoiceView.Payment_due_date = invoice.Payment_due_date
 
 	// Get Order Details
-	var order model.Order
-	err = orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order)
+	order, err := c.repos.Orders.Get(ctx, invoice.Order_id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while finding order"})
+		apperror.Write(w, r, apperror.Internal("error occured while finding order", err))
 		return
 	}
 
 	// Get Table Details
-	var table model.Table
 	if order.Table_id != nil {
-		err = tableCollection.FindOne(ctx, bson.M{"table_id": *order.Table_id}).Decode(&table)
+		table, err := c.repos.Tables.Get(ctx, *order.Table_id)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"message": "error occured while finding table"})
+			apperror.Write(w, r, apperror.Internal("error occured while finding table", err))
 			return
 		}
 		invoiceView.Table_number = table.Table_number
 	}
 
 	// Get Order Items and Calculate Payment Due
-	var orderItems []model.OrderItem
-	cursor, err := orderItemCollection.Find(ctx, bson.M{"order_id": invoice.Order_id})
+	orderItems, err := c.repos.OrderItems.ListByOrder(ctx, invoice.Order_id)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while finding order items"})
+		apperror.Write(w, r, apperror.Internal("error occured while finding order items", err))
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var paymentDue float64 = 0
-	for cursor.Next(ctx) {
-		var orderItem model.OrderItem
-		if err := cursor.Decode(&orderItem); err != nil {
-			log.Fatal(err)
-		}
-		if orderItem.Unit_price != nil {
-			paymentDue += *orderItem.Unit_price
-		}
-		orderItems = append(orderItems, orderItem)
-	}
-	invoiceView.Payment_due = paymentDue
+	invoiceView.Payment_due = paymentDue(orderItems)
 	invoiceView.Order_details = orderItems
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(invoiceView)
 }
 
-func CreateInvoice(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) CreateInvoice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var invoice model.Invoice
-	var order model.Order
 
 	if err := json.NewDecoder(r.Body).Decode(&invoice); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(invoice); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	err := orderCollection.FindOne(ctx, bson.M{"order_id": invoice.Order_id}).Decode(&order)
+	_, err := c.repos.Orders.Get(ctx, invoice.Order_id)
 	if err != nil {
-		msg := "message: Order was not found"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(msg)
+		apperror.Write(w, r, lookupError(err, "order"))
 		return
 	}
 
@@ -152,26 +134,32 @@ func CreateInvoice(w http.ResponseWriter, r *http.Request) {
 	invoice.ID = primitive.NewObjectID()
 	invoice.Invoice_id = invoice.ID.Hex()
 
-	result, insertErr := invoiceCollection.InsertOne(ctx, invoice)
+	_, insertErr := c.repos.Invoices.Create(ctx, invoice)
 	if insertErr != nil {
 		msg := "invoice item was not created"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+		apperror.Write(w, r, apperror.Internal(msg, insertErr))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	if isPaid(invoice.Payment_status) {
+		c.recordPayment(ctx, r, invoice.Order_id)
+	}
+	w.Header().Set("Location", "/invoices/"+invoice.Invoice_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invoice)
 }
 
-func UpdateInvoice(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) UpdateInvoice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	invoiceId := params["invoice_id"]
-	var invoice model.Invoice
+	var invoice InvoiceUpdate
 
 	if err := json.NewDecoder(r.Body).Decode(&invoice); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(invoice); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -184,50 +172,84 @@ func UpdateInvoice(w http.ResponseWriter, r *http.Request) {
 		updateObj = append(updateObj, bson.E{Key: "payment_status", Value: invoice.Payment_status})
 	}
 
-	invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: invoice.Updated_at})
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	filter := bson.M{"invoice_id": invoiceId}
-	upsert := true
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
+	// Only an invoice becoming paid counts towards the revenue. The update
+	// that makes it so is conditional, so of two racing to mark the same
+	// invoice paid only one counts it.
+	var updated *model.Invoice
+	var err error
+	if isPaid(invoice.Payment_status) {
+		updated, err = c.repos.Invoices.UpdateUnpaid(ctx, invoiceId, updateObj)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.Internal("error occured while updating the invoice", err))
+			return
+		}
+		if updated != nil {
+			c.recordPayment(ctx, r, updated.Order_id)
+		}
 	}
-
-	result, err := invoiceCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
-
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "invoice item update failed"})
-		return
+	if updated == nil {
+		updated, err = c.repos.Invoices.UpdateAndGet(ctx, invoiceId, updateObj)
+		if err != nil {
+			apperror.Write(w, r, lookupError(err, "invoice"))
+			return
+		}
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(updated)
 }
 
-func DeleteInvoice(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DeleteInvoice(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	invoiceId := params["invoice_id"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := invoiceCollection.DeleteOne(ctx, bson.M{"invoice_id": invoiceId})
+	result, err := c.repos.Invoices.Delete(ctx, invoiceId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while deleting the invoice item"})
+		apperror.Write(w, r, apperror.Internal("error occured while deleting the invoice item", err))
 		return
 	}
 
 	if result.DeletedCount < 1 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "invoice with this ID not found"})
+		apperror.Write(w, r, apperror.NotFound("invoice with this ID not found"))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Invoice deleted successfully"})
 }
+
+func isPaid(paymentStatus *string) bool {
+	return paymentStatus != nil && *paymentStatus == "PAID"
+}
+
+// paymentDue is the sum of the prices of orderItems.
+func paymentDue(orderItems []model.OrderItem) float64 {
+	var due float64
+	for _, orderItem := range orderItems {
+		if orderItem.Unit_price != nil {
+			due += *orderItem.Unit_price
+		}
+	}
+	return due
+}
+
+// recordPayment counts an invoice for orderId as paid in the business
+// metrics. A failure to work out the amount is only logged.
+func (c *Controller) recordPayment(ctx context.Context, r *http.Request, orderId string) {
+	metrics.InvoicesPaid.Inc()
+	orderItems, err := c.repos.OrderItems.ListByOrder(ctx, orderId)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("computing revenue of paid invoice", "order_id", orderId, "error", err)
+		return
+	}
+	metrics.Revenue.Add(paymentDue(orderItems))
+}
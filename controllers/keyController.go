@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/datmedevil17/restaurant-management/helpers"
+)
+
+// GetJWKS publishes the public keys tokens are signed with.
+func (c *Controller) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(helpers.PublicJWKS())
+}
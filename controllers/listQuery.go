@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+)
+
+const maxListLimit = 100
+
+// ListResponse is the envelope every listing is sent in. Next_cursor is null
+// on the last page; Total is only sent when asked for with ?total=true.
+type ListResponse[T any] struct {
+	Items       []T     `json:"items"`
+	Next_cursor *string `json:"next_cursor"`
+	Total       *int64  `json:"total,omitempty"`
+}
+
+func newListResponse[T any](page *repository.Page[T]) ListResponse[T] {
+	return newListResponseOf(page, func(item *T) T { return *item })
+}
+
+// newListResponseOf sends page with each item replaced by its view.
+func newListResponseOf[T any, V any](page *repository.Page[T], view func(*T) V) ListResponse[V] {
+	response := ListResponse[V]{Items: make([]V, 0, len(page.Items)), Total: page.Total}
+	for i := range page.Items {
+		response.Items = append(response.Items, view(&page.Items[i]))
+	}
+	if page.Next_cursor != "" {
+		response.Next_cursor = &page.Next_cursor
+	}
+	return response
+}
+
+// parseListQuery reads the paging parameters every listing takes (limit,
+// cursor, sort, total, created_after and created_before) and the equality
+// filters of filters, which maps query parameters to document fields.
+func parseListQuery(r *http.Request, filters map[string]string) (repository.ListQuery, error) {
+	values := r.URL.Query()
+	query := repository.ListQuery{
+		Limit:   repository.DefaultListLimit,
+		Cursor:  values.Get("cursor"),
+		Filters: map[string]interface{}{},
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxListLimit {
+			return query, apperror.Validation("limit must be a number from 1 to " + strconv.Itoa(maxListLimit))
+		}
+		query.Limit = n
+	}
+
+	sort := values.Get("sort")
+	query.Descending = strings.HasPrefix(sort, "-")
+	switch query.Sort = strings.TrimPrefix(sort, "-"); query.Sort {
+	case "", repository.SortID, repository.SortCreatedAt:
+	default:
+		return query, apperror.Validation("sort must be _id or created_at, prefixed with - for descending order")
+	}
+
+	if total := values.Get("total"); total != "" {
+		withTotal, err := strconv.ParseBool(total)
+		if err != nil {
+			return query, apperror.Validation("total must be true or false")
+		}
+		query.WithTotal = withTotal
+	}
+
+	for param, bound := range map[string]**time.Time{
+		"created_after":  &query.Created_after,
+		"created_before": &query.Created_before,
+	} {
+		if value := values.Get(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, apperror.Validation(param + " must be an RFC 3339 time")
+			}
+			*bound = &t
+		}
+	}
+
+	for param, field := range filters {
+		if value := values.Get(param); value != "" {
+			query.Filters[field] = value
+		}
+	}
+	return query, nil
+}
+
+// listError reports a failed listing of what.
+func listError(err error, what string) error {
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return apperror.Validation("cursor is not valid for this listing")
+	}
+	return apperror.Internal("error occured while listing "+what, err)
+}
@@ -4,78 +4,59 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
 	"net/http"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/apperror"
 	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var menuCollection *mongo.Collection = database.OpenCollection(database.Client, "menu")
+// MenuUpdate is the body of PUT and PATCH /menus/{menu_id}; absent fields are
+// left unchanged. The dates are only changed together.
+type MenuUpdate struct {
+	Name       *string    `json:"name" validate:"required_without_all=Category Start_Date,omitnil,min=1"`
+	Category   *string    `json:"category" validate:"omitnil,min=1"`
+	Start_Date *time.Time `json:"start_date" validate:"required_with=End_Date"`
+	End_Date   *time.Time `json:"end_date" validate:"required_with=Start_Date"`
+}
 
-func getMenu(menuId string) (*model.Menu, error) {
-	fId, err := primitive.ObjectIDFromHex(menuId)
-	if err != nil {
-		log.Fatal(err)
-	}
-	var menu model.Menu
-	filter := bson.M{"_id": fId}
-	err = menuCollection.FindOne(context.TODO(), filter).Decode(&menu)
-	if err != nil {
-		return nil, err
-	}
-	return &menu, err
+func (c *Controller) getMenu(ctx context.Context, menuId string) (*model.Menu, error) {
+	return c.repos.Menus.Get(ctx, menuId)
 }
 
-func getMenus() ([]model.Menu, error) {
-	var menus []model.Menu
-	cursor, err := menuCollection.Find(context.TODO(), bson.M{})
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(context.TODO())
-	for cursor.Next(context.TODO()) {
-		var menu model.Menu
-		err := cursor.Decode(&menu)
-		if err != nil {
-			return nil, err
-		}
-		menus = append(menus, menu)
-	}
-	return menus, nil
+func (c *Controller) getMenus(ctx context.Context, query repository.ListQuery) (*repository.Page[model.Menu], error) {
+	return c.repos.Menus.ListPage(ctx, query)
 }
 
-func createMenu(menu model.Menu) (*model.Menu, error) {
+func (c *Controller) createMenu(ctx context.Context, menu model.Menu) (*model.Menu, error) {
 	menu.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	result, err := menuCollection.InsertOne(context.TODO(), menu)
+	menu.ID = primitive.NewObjectID()
+	menu.Menu_id = menu.ID.Hex()
+	_, err := c.repos.Menus.Create(ctx, menu)
 	if err != nil {
 		return nil, err
 	}
-	menu.ID = result.InsertedID.(primitive.ObjectID)
 	return &menu, nil
 }
 
-func updateMenu(menuId string, menu model.Menu) (*model.Menu, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (c *Controller) updateMenu(ctx context.Context, menuId string, menu MenuUpdate) (*model.Menu, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	fId, err := primitive.ObjectIDFromHex(menuId)
-	if err != nil {
-		return nil, err
+	if _, err := primitive.ObjectIDFromHex(menuId); err != nil {
+		return nil, apperror.NotFound("Menu not found")
 	}
 
-	filter := bson.M{"_id": fId}
 	var updateObj bson.D
 
 	if menu.Start_Date != nil && menu.End_Date != nil {
 		if !inTimeSpan(*menu.Start_Date, *menu.End_Date, time.Now()) {
-			return nil, errors.New("kindly retype the time")
+			return nil, apperror.Validation("kindly retype the time")
 		}
 		updateObj = append(updateObj,
 			bson.E{Key: "start_date", Value: menu.Start_Date},
@@ -83,44 +64,32 @@ func updateMenu(menuId string, menu model.Menu) (*model.Menu, error) {
 		)
 	}
 
-	if menu.Name != "" {
+	if menu.Name != nil {
 		updateObj = append(updateObj, bson.E{Key: "name", Value: menu.Name})
 	}
 
-	if menu.Category != "" {
+	if menu.Category != nil {
 		updateObj = append(updateObj, bson.E{Key: "category", Value: menu.Category})
 	}
 
-	menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: menu.Updated_at})
-
-	if len(updateObj) == 0 {
-		return nil, errors.New("no fields to update")
-	}
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
 
-	_, err = menuCollection.UpdateOne(
-		ctx,
-		filter,
-		bson.M{"$set": updateObj},
-	)
+	updatedMenu, err := c.repos.Menus.UpdateAndGet(ctx, menuId, updateObj)
 	if err != nil {
-		return nil, err
+		return nil, lookupError(err, "menu")
 	}
-
-	menu.ID = fId
-	return &menu, nil
+	return updatedMenu, nil
 }
 
-func deleteMenu(menuId string) error {
-	fId, err := primitive.ObjectIDFromHex(menuId)
-	if err != nil {
-		log.Fatal(err)
-	}
-	filter := bson.M{"_id": fId}
-	_, err = menuCollection.DeleteOne(context.TODO(), filter)
+func (c *Controller) deleteMenu(ctx context.Context, menuId string) error {
+	result, err := c.repos.Menus.Delete(ctx, menuId)
 	if err != nil {
 		return err
 	}
+	if result.DeletedCount < 1 {
+		return repository.ErrNotFound
+	}
 	return nil
 }
 
@@ -134,89 +103,102 @@ func inTimeSpan(start, end, check time.Time) bool {
 //updateMenu
 //deleteMenu
 
-func GetMenu(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetMenu(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "GET")
 	params := mux.Vars(r)
 	menuId := params["menu_id"]
-	menu, err := getMenu(menuId)
+	menu, err := c.getMenu(r.Context(), menuId)
 	if err != nil {
-		if err.Error() == "food not found" {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]string{"message": "Food not found"})
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("Menu not found"))
 			return
 		}
+		apperror.Write(w, r, apperror.Internal("Internal server error", err))
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(menu)
 }
 
-func GetMenus(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetMenus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "GET")
-	menus, err := getMenus()
+	query, err := parseListQuery(r, map[string]string{"category": "category"})
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	menus, err := c.getMenus(r.Context(), query)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		apperror.Write(w, r, listError(err, "menus"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(menus)
+	json.NewEncoder(w).Encode(newListResponse(menus))
 }
 
-func CreateMenu(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) CreateMenu(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "POST")
 	var menu model.Menu
 	err := json.NewDecoder(r.Body).Decode(&menu)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Bad request"})
+		apperror.Write(w, r, apperror.Validation("Bad request"))
 		return
 	}
-	createdMenu, err := createMenu(menu)
+	if err := validateBody(menu); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	createdMenu, err := c.createMenu(r.Context(), menu)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		apperror.Write(w, r, apperror.Internal("Internal server error", err))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Location", "/menus/"+createdMenu.Menu_id)
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(createdMenu)
 }
 
-func DeleteMenu(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DeleteMenu(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "DELETE")
 	params := mux.Vars(r)
 	menuId := params["menu_id"]
-	err := deleteMenu(menuId)
+	err := c.deleteMenu(r.Context(), menuId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Internal server error"})
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("Menu not found"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("Internal server error", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Menu deleted successfully"})
 }
-func UpdateMenu(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) UpdateMenu(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "PUT")
 
 	params := mux.Vars(r)
 	menuId := params["menu_id"]
 
-	var menu model.Menu
+	var menu MenuUpdate
 	if err := json.NewDecoder(r.Body).Decode(&menu); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Bad request"})
+		apperror.Write(w, r, apperror.Validation("Bad request"))
+		return
+	}
+	if err := validateBody(menu); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	updatedMenu, err := updateMenu(menuId, menu)
+	updatedMenu, err := c.updateMenu(r.Context(), menuId, menu)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -0,0 +1,480 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	"github.com/datmedevil17/restaurant-management/logging"
+	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at a time.
+const recoveryCodeCount = 10
+
+// MFASettings configure TOTP two-factor authentication.
+type MFASettings struct {
+	// Issuer names the service in authenticator apps.
+	Issuer string
+	// RequiredRoles must enrol before they can finish logging in.
+	RequiredRoles []string
+	// PendingTTL is how long an mfa_pending token stays valid.
+	PendingTTL time.Duration
+}
+
+// MFAChallenge is the answer to a correct password when a second factor is
+// still needed. Mfa_token is accepted by /users/login/mfa or, when
+// enrolment is required, by the TOTP enrolment endpoints.
+type MFAChallenge struct {
+	Mfa_required           bool   `json:"mfa_required"`
+	Mfa_enrolment_required bool   `json:"mfa_enrolment_required"`
+	Mfa_token              string `json:"mfa_token"`
+}
+
+// TOTPEnrolment is the answer to SetupTOTP.
+type TOTPEnrolment struct {
+	Secret      string `json:"secret"`
+	Otpauth_uri string `json:"otpauth_uri"`
+}
+
+// RecoveryCodes are shown once and stored only as hashes. When enrolment
+// finishes a login, the token pair is returned along with them.
+type RecoveryCodes struct {
+	Recovery_codes []string `json:"recovery_codes"`
+	*LoginResponse
+}
+
+// SecondFactor is a TOTP code or, if the authenticator is lost, one of the
+// user's recovery codes.
+type SecondFactor struct {
+	Code          string `json:"code"`
+	Recovery_code string `json:"recovery_code"`
+}
+
+// MFALogin is the body of POST /users/login/mfa.
+type MFALogin struct {
+	Mfa_token string `json:"mfa_token"`
+	SecondFactor
+}
+
+// TOTPConfirmation is the body of POST /users/mfa/totp/confirm.
+type TOTPConfirmation struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// mfaRequired reports whether the role of user has to use a second factor.
+func (c *Controller) mfaRequired(user *model.User) bool {
+	if user.Role == nil {
+		return false
+	}
+	return slices.ContainsFunc(c.mfa.RequiredRoles, func(role string) bool {
+		return strings.EqualFold(role, *user.Role)
+	})
+}
+
+func (c *Controller) challengeMFA(w http.ResponseWriter, r *http.Request, foundUser *model.User) {
+	var role string
+	if foundUser.Role != nil {
+		role = *foundUser.Role
+	}
+
+	mfaToken, err := helpers.GenerateMFAPendingToken(stringValue(foundUser.Email), foundUser.User_id, role, c.mfa.PendingTTL)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while generating the mfa token", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MFAChallenge{
+		Mfa_required:           foundUser.Mfa_enabled,
+		Mfa_enrolment_required: !foundUser.Mfa_enabled,
+		Mfa_token:              mfaToken,
+	})
+}
+
+// useSecondFactor verifies factor for user and uses it up, recording the
+// TOTP step it was valid for or removing the recovery code. The write only
+// matches while the factor is unused, so when two requests race with the
+// same code only one of them gets true.
+func (c *Controller) useSecondFactor(ctx context.Context, user *model.User, factor SecondFactor) (bool, error) {
+	if factor.Code != "" && user.Totp_secret != nil {
+		step, ok := helpers.ValidateTOTP(*user.Totp_secret, factor.Code, time.Now(), user.Totp_last_step)
+		if !ok {
+			return false, nil
+		}
+		return c.repos.Users.UseTOTPStep(ctx, user.User_id, step)
+	}
+
+	if factor.Recovery_code != "" {
+		hash := helpers.HashRecoveryCode(factor.Recovery_code)
+		if !slices.Contains(user.Recovery_codes, hash) {
+			return false, nil
+		}
+		return c.repos.Users.UseRecoveryCode(ctx, user.User_id, hash)
+	}
+
+	return false, nil
+}
+
+// LoginMFA finishes a login started with a password by checking the second
+// factor against the mfa_pending token Login handed out.
+func (c *Controller) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var body MFALogin
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Mfa_token == "" || (body.Code == "" && body.Recovery_code == "") {
+		apperror.Write(w, r, apperror.Validation("mfa_token and a code or recovery_code are required"))
+		return
+	}
+
+	claims, msg := helpers.ValidateToken(body.Mfa_token)
+	if msg == "" && claims.Token_type != helpers.MFAPendingToken {
+		msg = "not an mfa token"
+	}
+	if msg == "" {
+		revoked, err := c.revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while checking the token", err))
+			return
+		}
+		if revoked {
+			msg = "token has been revoked"
+		}
+	}
+	if msg != "" {
+		apperror.Write(w, r, apperror.Unauthorized("mfa token is invalid or has expired, please log in again"))
+		return
+	}
+
+	ip := c.clientIP(r)
+	retryAfter, err := c.logins.Check(ctx, claims.Email, ip)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while checking login attempts", err))
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		apperror.Write(w, r, apperror.TooManyRequests("too many failed login attempts, try again later"))
+		return
+	}
+
+	foundUser, err := c.repos.Users.Get(ctx, claims.Uid)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.Unauthorized("mfa token is invalid or has expired, please log in again"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+	if !foundUser.IsActive() {
+		apperror.Write(w, r, apperror.Forbidden("this account has been deactivated"))
+		return
+	}
+	if !foundUser.Mfa_enabled {
+		apperror.Write(w, r, apperror.Conflict("two-factor authentication is not set up, enrol first"))
+		return
+	}
+
+	ok, err := c.useSecondFactor(ctx, foundUser, body.SecondFactor)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while recording the two-factor code", err))
+		return
+	}
+	if !ok {
+		if err := c.logins.Fail(ctx, claims.Email, ip); err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while recording the login attempt", err))
+			return
+		}
+		apperror.Write(w, r, apperror.Unauthorized("invalid two-factor code"))
+		return
+	}
+	if err := c.logins.Succeed(ctx, claims.Email); err != nil {
+		logging.FromContext(r.Context()).Warn("resetting login attempts", "error", err)
+	}
+	// Each password check is good for one login only.
+	if err := c.revocations.Revoke(ctx, claims); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking the mfa token", err))
+		return
+	}
+
+	c.completeLogin(ctx, w, r, foundUser)
+}
+
+// SetupTOTP starts enrolment by generating a new secret for the caller. It
+// takes effect once ConfirmTOTP has seen a code made from it.
+func (c *Controller) SetupTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	claims := currentUserClaims(w, r)
+	if claims == nil {
+		return
+	}
+	foundUser, err := c.findUser(ctx, claims.Uid)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if foundUser.Mfa_enabled {
+		apperror.Write(w, r, apperror.Conflict("two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, err := helpers.NewTOTPSecret()
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while generating the secret", err))
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "totp_secret", Value: secret},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, foundUser.User_id, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "error occured while storing the secret"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TOTPEnrolment{
+		Secret:      secret,
+		Otpauth_uri: helpers.TOTPURI(c.mfa.Issuer, stringValue(foundUser.Email), secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication with the secret from
+// SetupTOTP and hands out recovery codes. Called with an mfa_pending token,
+// it also finishes the login that required the enrolment.
+func (c *Controller) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var body TOTPConfirmation
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(body); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	claims := currentUserClaims(w, r)
+	if claims == nil {
+		return
+	}
+	foundUser, err := c.findUser(ctx, claims.Uid)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if foundUser.Mfa_enabled {
+		apperror.Write(w, r, apperror.Conflict("two-factor authentication is already enabled"))
+		return
+	}
+	if foundUser.Totp_secret == nil {
+		apperror.Write(w, r, apperror.Conflict("start enrolment with /users/mfa/totp/setup first"))
+		return
+	}
+
+	step, ok := helpers.ValidateTOTP(*foundUser.Totp_secret, body.Code, time.Now(), foundUser.Totp_last_step)
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("invalid two-factor code"))
+		return
+	}
+
+	codes, hashes, err := helpers.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while generating recovery codes", err))
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "mfa_enabled", Value: true},
+		{Key: "totp_last_step", Value: step},
+		{Key: "recovery_codes", Value: hashes},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, foundUser.User_id, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "error occured while enabling two-factor authentication"))
+		return
+	}
+
+	if claims.Token_type != helpers.MFAPendingToken {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(RecoveryCodes{Recovery_codes: codes})
+		return
+	}
+
+	if err := c.revocations.Revoke(ctx, claims); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking the mfa token", err))
+		return
+	}
+
+	response, err := c.newLogin(ctx, foundUser)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal(err.Error(), err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodes{Recovery_codes: codes, LoginResponse: response})
+}
+
+// DisableTOTP turns two-factor authentication off for the caller, who has
+// to prove they still hold a second factor. Roles that require it cannot.
+func (c *Controller) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var factor SecondFactor
+	if err := json.NewDecoder(r.Body).Decode(&factor); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+
+	claims := currentUserClaims(w, r)
+	if claims == nil {
+		return
+	}
+	foundUser, err := c.findUser(ctx, claims.Uid)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if c.mfaRequired(foundUser) {
+		apperror.Write(w, r, apperror.Forbidden("two-factor authentication is mandatory for your role"))
+		return
+	}
+	if !foundUser.Mfa_enabled {
+		apperror.Write(w, r, apperror.Conflict("two-factor authentication is not enabled"))
+		return
+	}
+	ok, err := c.useSecondFactor(ctx, foundUser, factor)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while recording the two-factor code", err))
+		return
+	}
+	if !ok {
+		apperror.Write(w, r, apperror.Forbidden("invalid two-factor code"))
+		return
+	}
+
+	if err := c.clearMFA(ctx, foundUser.User_id); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes with new ones.
+func (c *Controller) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	var factor SecondFactor
+	if err := json.NewDecoder(r.Body).Decode(&factor); err != nil || factor.Code == "" {
+		apperror.Write(w, r, apperror.Validation("code is required"))
+		return
+	}
+
+	claims := currentUserClaims(w, r)
+	if claims == nil {
+		return
+	}
+	foundUser, err := c.findUser(ctx, claims.Uid)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if !foundUser.Mfa_enabled {
+		apperror.Write(w, r, apperror.Conflict("two-factor authentication is not enabled"))
+		return
+	}
+	ok, err := c.useSecondFactor(ctx, foundUser, SecondFactor{Code: factor.Code})
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while recording the two-factor code", err))
+		return
+	}
+	if !ok {
+		apperror.Write(w, r, apperror.Forbidden("invalid two-factor code"))
+		return
+	}
+
+	codes, hashes, err := helpers.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while generating recovery codes", err))
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "recovery_codes", Value: hashes},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, foundUser.User_id, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "error occured while storing recovery codes"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RecoveryCodes{Recovery_codes: codes})
+}
+
+// ResetMFA lets an admin remove the second factor of a user who lost it. If
+// their role requires one they will have to enrol again at their next login.
+func (c *Controller) ResetMFA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+	if _, err := c.findUser(ctx, userId); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+	if err := c.clearMFA(ctx, userId); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication reset"})
+}
+
+// clearMFA removes every second factor of userId.
+func (c *Controller) clearMFA(ctx context.Context, userId string) error {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "mfa_enabled", Value: false},
+		{Key: "totp_secret", Value: nil},
+		{Key: "recovery_codes", Value: nil},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, userId, updateObj); err != nil {
+		return updateError(err, "user", "error occured while disabling two-factor authentication")
+	}
+	return nil
+}
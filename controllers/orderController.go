@@ -3,180 +3,165 @@ package controller
 import (
 	"context"
 	"encoding/json"
-	"log"
 
 	"net/http"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/metrics"
 	model "github.com/datmedevil17/restaurant-management/models"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var orderCollection *mongo.Collection = database.OpenCollection(database.Client, "order")
-var tableCollection *mongo.Collection = database.OpenCollection(database.Client, "table")
+// OrderUpdate is the body of PUT and PATCH /orders/{order_id}; absent fields
+// are left unchanged.
+type OrderUpdate struct {
+	Table_id *string `json:"table_id" validate:"omitnil,min=1"`
+}
 
-func GetOrders(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetOrders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var orders []model.Order
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := orderCollection.Find(context.TODO(), bson.M{})
+	query, err := parseListQuery(r, map[string]string{"table_id": "table_id"})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing order items"})
+		apperror.Write(w, r, err)
 		return
 	}
-	defer result.Close(ctx)
-	for result.Next(ctx) {
-		var order model.Order
-		if err := result.Decode(&order); err != nil {
-			log.Fatal(err)
-		}
-		orders = append(orders, order)
+
+	orders, err := c.repos.Orders.ListPage(ctx, query)
+	if err != nil {
+		apperror.Write(w, r, listError(err, "orders"))
+		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(orders)
+	json.NewEncoder(w).Encode(newListResponse(orders))
 }
 
-func GetOrder(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	orderId := params["order_id"]
-	var order model.Order
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	err := orderCollection.FindOne(ctx, bson.M{"order_id": orderId}).Decode(&order)
+	order, err := c.repos.Orders.Get(ctx, orderId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while fetching the order item"})
+		apperror.Write(w, r, lookupError(err, "order"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(order)
 }
 
-func CreateOrder(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var order model.Order
-	var table model.Table
 
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+
+	order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	if err := validateBody(order); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
 	if order.Table_id != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 		defer cancel()
-		tableID := *order.Table_id
-		err := tableCollection.FindOne(ctx, bson.M{"table_id": tableID}).Decode(&table)
+		_, err := c.repos.Tables.Get(ctx, *order.Table_id)
 		if err != nil {
-			msg := "message: Table was not found"
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(msg)
+			apperror.Write(w, r, lookupError(err, "table"))
 			return
 		}
 	}
 
 	order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, insertErr := orderCollection.InsertOne(ctx, order)
+	_, insertErr := c.repos.Orders.Create(ctx, order)
 	if insertErr != nil {
 		msg := "order item was not created"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+		apperror.Write(w, r, apperror.Internal(msg, insertErr))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	metrics.OrdersCreated.Inc()
+	w.Header().Set("Location", "/orders/"+order.Order_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
 }
 
-func UpdateOrder(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	orderId := params["order_id"]
-	var order model.Order
-	var table model.Table
+	var order OrderUpdate
 
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(order); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
 	var updateObj bson.D
 
 	if order.Table_id != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 		defer cancel()
-		tableID := *order.Table_id
-		err := tableCollection.FindOne(ctx, bson.M{"table_id": tableID}).Decode(&table)
+		_, err := c.repos.Tables.Get(ctx, *order.Table_id)
 		if err != nil {
-			msg := "message: Table was not found"
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(msg)
+			apperror.Write(w, r, lookupError(err, "table"))
 			return
 		}
 		updateObj = append(updateObj, bson.E{Key: "table_id", Value: order.Table_id})
 	}
 
-	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: order.Updated_at})
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	filter := bson.M{"order_id": orderId}
-	upsert := true
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	result, err := orderCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
-
+	updated, err := c.repos.Orders.UpdateAndGet(ctx, orderId, updateObj)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "order item update failed"})
+		apperror.Write(w, r, lookupError(err, "order"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(updated)
 }
 
-func DeleteOrder(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	orderId := params["order_id"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := orderCollection.DeleteOne(ctx, bson.M{"order_id": orderId})
+	result, err := c.repos.Orders.Delete(ctx, orderId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while deleting the order item"})
+		apperror.Write(w, r, apperror.Internal("error occured while deleting the order item", err))
 		return
 	}
 
 	if result.DeletedCount < 1 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "order with this ID not found"})
+		apperror.Write(w, r, apperror.NotFound("order with this ID not found"))
 		return
 	}
 
@@ -184,16 +169,20 @@ func DeleteOrder(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Order deleted successfully"})
 }
 
-func OrderItemOrderCreator(order model.Order) string {
+// OrderItemOrderCreator stores a new order for a batch of order items and
+// returns it. Its id is only generated if order does not have one yet. The
+// order is not counted in the metrics until its items are stored too.
+func (c *Controller) OrderItemOrderCreator(ctx context.Context, order model.Order) (*model.Order, error) {
 	order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	order.ID = primitive.NewObjectID()
-	order.Order_id = order.ID.Hex()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
+	if order.ID.IsZero() {
+		order.ID = primitive.NewObjectID()
+		order.Order_id = order.ID.Hex()
+	}
 
-	orderCollection.InsertOne(ctx, order)
-	return order.Order_id
+	if _, err := c.repos.Orders.Create(ctx, order); err != nil {
+		return nil, err
+	}
+	return &order, nil
 }
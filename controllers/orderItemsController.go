@@ -3,169 +3,137 @@ package controller
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/logging"
+	"github.com/datmedevil17/restaurant-management/metrics"
 	model "github.com/datmedevil17/restaurant-management/models"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrderItemPack struct {
-	Table_id    *string           `json:"table_id"`
+	Table_id    *string           `json:"table_id" validate:"required"`
+	Order_items []model.OrderItem `json:"order_items" validate:"required,min=1,dive"`
+}
+
+// OrderItemsCreated is the answer to POST /order-items: the order that was
+// opened and the items stored in it.
+type OrderItemsCreated struct {
+	Order       model.Order       `json:"order"`
 	Order_items []model.OrderItem `json:"order_items"`
 }
 
-var orderItemCollection *mongo.Collection = database.OpenCollection(database.Client, "order_item")
+// OrderItemUpdate is the body of PUT and PATCH /order-items/{order_item_id};
+// absent fields are left unchanged.
+type OrderItemUpdate struct {
+	Quantity   *string  `json:"quantity" validate:"omitnil,oneof=S M L"`
+	Unit_price *float64 `json:"unit_price" validate:"omitnil,gt=0"`
+	Food_id    *string  `json:"food_id" validate:"omitnil,min=1"`
+}
 
-func GetOrderItems(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetOrderItems(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var orderItems []model.OrderItem
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := orderItemCollection.Find(context.TODO(), bson.M{})
+	query, err := parseListQuery(r, map[string]string{"order_id": "order_id", "food_id": "food_id"})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing order items"})
+		apperror.Write(w, r, err)
 		return
 	}
-	defer result.Close(ctx)
-	for result.Next(ctx) {
-		var orderItem model.OrderItem
-		if err := result.Decode(&orderItem); err != nil {
-			log.Fatal(err)
-		}
-		orderItems = append(orderItems, orderItem)
+
+	orderItems, err := c.repos.OrderItems.ListPage(ctx, query)
+	if err != nil {
+		apperror.Write(w, r, listError(err, "order items"))
+		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(orderItems)
+	json.NewEncoder(w).Encode(newListResponse(orderItems))
 }
 
-func GetOrderItem(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	orderItemId := params["order_item_id"]
-	var orderItem model.OrderItem
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	err := orderItemCollection.FindOne(ctx, bson.M{"order_item_id": orderItemId}).Decode(&orderItem)
+	orderItem, err := c.repos.OrderItems.Get(ctx, orderItemId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing order item"})
+		apperror.Write(w, r, lookupError(err, "order item"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(orderItem)
 }
 
-func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+func (c *Controller) ItemsByOrder(ctx context.Context, id string) (OrderItems []primitive.M, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Second)
 	defer cancel()
 
-	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: id}}}}
-	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "food"}, {Key: "localField", Value: "food_id"}, {Key: "foreignField", Value: "food_id"}, {Key: "as", Value: "food"}}}}
-	unwindStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$food"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
-
-	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "order"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order"}}}}
-	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
-
-	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "table"}, {Key: "localField", Value: "order.table_id"}, {Key: "foreignField", Value: "table_id"}, {Key: "as", Value: "table"}}}}
-	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$table"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
-
-	projectStage := bson.D{
-		{Key: "$project", Value: bson.D{
-			{Key: "id", Value: 0},
-			{Key: "amount", Value: "$food.price"},
-			{Key: "total_count", Value: 1},
-			{Key: "food_name", Value: "$food.name"},
-			{Key: "food_image", Value: "$food.food_image"},
-			{Key: "table_number", Value: "$table.table_number"},
-			{Key: "table_id", Value: "$table.table_id"},
-			{Key: "order_id", Value: "$order.order_id"},
-			{Key: "price", Value: "$food.price"},
-			{Key: "quantity", Value: 1},
-		}}}
-
-	groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "order_id", Value: "$order_id"}, {Key: "table_id", Value: "$table_id"}, {Key: "table_number", Value: "$table_number"}}}, {Key: "order_items", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}}}}}
-
-	projectStage2 := bson.D{
-		{Key: "$project", Value: bson.D{
-			{Key: "id", Value: 0},
-			{Key: "payment_due", Value: 1},
-			{Key: "total_count", Value: 1},
-			{Key: "table_number", Value: "$_id.table_number"},
-			{Key: "order_items", Value: 1},
-		}}}
-
-	var allStages mongo.Pipeline
-
-	allStages = append(allStages, matchStage)
-	allStages = append(allStages, lookupStage)
-	allStages = append(allStages, unwindStage)
-	allStages = append(allStages, lookupOrderStage)
-	allStages = append(allStages, unwindOrderStage)
-	allStages = append(allStages, lookupTableStage)
-	allStages = append(allStages, unwindTableStage)
-	allStages = append(allStages, projectStage)
-	allStages = append(allStages, groupStage)
-	allStages = append(allStages, projectStage2)
-
-	result, err := orderItemCollection.Aggregate(ctx, allStages)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if err = result.All(ctx, &OrderItems); err != nil {
-		return nil, err
-	}
-
-	return OrderItems, err
+	return c.repos.OrderItems.ItemsByOrder(ctx, id)
 }
 
-func GetOrderItemsByOrder(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetOrderItemsByOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	orderId := params["order_id"]
 
-	allOrderItems, err := ItemsByOrder(orderId)
+	allOrderItems, err := c.ItemsByOrder(r.Context(), orderId)
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing order items by order ID"})
+		apperror.Write(w, r, apperror.Internal("error occured while listing order items by order ID", err))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(allOrderItems)
 }
 
-func CreateOrderItem(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) CreateOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var orderItemPack OrderItemPack
 	var order model.Order
 
 	if err := json.NewDecoder(r.Body).Decode(&orderItemPack); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+
+	// The order's id is settled first so that the items, which must name
+	// their order, can be validated before anything is written.
+	order.ID = primitive.NewObjectID()
+	order.Order_id = order.ID.Hex()
+	for i := range orderItemPack.Order_items {
+		orderItemPack.Order_items[i].Order_id = order.Order_id
+	}
+	if err := validateBody(orderItemPack); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	if _, err := c.repos.Tables.Get(ctx, *orderItemPack.Table_id); err != nil {
+		apperror.Write(w, r, lookupError(err, "table"))
 		return
 	}
 
 	order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	orderItemsToBeInserted := []interface{}{}
+	orderItemsToBeInserted := []model.OrderItem{}
 	order.Table_id = orderItemPack.Table_id
-	order_id := OrderItemOrderCreator(order)
+	createdOrder, err := c.OrderItemOrderCreator(ctx, order)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("order was not created", err))
+		return
+	}
 
 	for _, orderItem := range orderItemPack.Order_items {
-		orderItem.Order_id = order_id
-
 		orderItem.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		orderItem.ID = primitive.NewObjectID()
@@ -174,23 +142,33 @@ func CreateOrderItem(w http.ResponseWriter, r *http.Request) {
 		orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
 	}
 
-	insertedOrderItems, err := orderItemCollection.InsertMany(context.TODO(), orderItemsToBeInserted)
-	if err != nil {
-		log.Fatal(err)
+	if _, err := c.repos.OrderItems.CreateMany(ctx, orderItemsToBeInserted); err != nil {
+		// An order without its items would be billed as empty.
+		if _, deleteErr := c.repos.Orders.Delete(ctx, createdOrder.Order_id); deleteErr != nil {
+			logging.FromContext(r.Context()).Warn("removing order after its items failed", "order_id", createdOrder.Order_id, "error", deleteErr)
+		}
+		apperror.Write(w, r, apperror.Internal("order items were not created", err))
+		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(insertedOrderItems)
+	metrics.OrdersCreated.Inc()
+	metrics.ItemsOrdered.Add(float64(len(orderItemsToBeInserted)))
+	w.Header().Set("Location", "/orders/"+createdOrder.Order_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(OrderItemsCreated{Order: *createdOrder, Order_items: orderItemsToBeInserted})
 }
 
-func UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var orderItem model.OrderItem
+	var orderItem OrderItemUpdate
 	params := mux.Vars(r)
 	orderItemId := params["order_item_id"]
 
 	if err := json.NewDecoder(r.Body).Decode(&orderItem); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(orderItem); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -208,44 +186,34 @@ func UpdateOrderItem(w http.ResponseWriter, r *http.Request) {
 		updateObj = append(updateObj, bson.E{Key: "food_id", Value: orderItem.Food_id})
 	}
 
-	orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: orderItem.Updated_at})
-
-	filter := bson.M{"order_item_id": orderItemId}
-	upsert := true
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	result, err := orderItemCollection.UpdateOne(context.TODO(), filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
 
+	updated, err := c.repos.OrderItems.UpdateAndGet(r.Context(), orderItemId, updateObj)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "order item update failed"})
+		apperror.Write(w, r, lookupError(err, "order item"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(updated)
 }
 
-func DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DeleteOrderItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	orderItemId := params["order_item_id"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := orderItemCollection.DeleteOne(ctx, bson.M{"order_item_id": orderItemId})
+	result, err := c.repos.OrderItems.Delete(ctx, orderItemId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while deleting the order item"})
+		apperror.Write(w, r, apperror.Internal("error occured while deleting the order item", err))
 		return
 	}
 
 	if result.DeletedCount < 1 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "order item with this ID not found"})
+		apperror.Write(w, r, apperror.NotFound("order item with this ID not found"))
 		return
 	}
 
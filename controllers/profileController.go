@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/auth"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	model "github.com/datmedevil17/restaurant-management/models"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UserUpdate is the body of PATCH /users/{user_id}; absent fields are left
+// unchanged and an empty avatar removes it.
+type UserUpdate struct {
+	First_name *string `json:"first_name" validate:"omitnil,min=2,max=100"`
+	Last_name  *string `json:"last_name" validate:"omitnil,min=2,max=100"`
+	Phone      *string `json:"phone" validate:"omitnil,min=1,max=20"`
+	Avatar     *string `json:"avatar" validate:"omitempty,url"`
+}
+
+// PasswordChange is the body of POST /users/{user_id}/password.
+type PasswordChange struct {
+	Old_password *string `json:"old_password" validate:"required"`
+	New_password *string `json:"new_password" validate:"required,nefield=Old_password"`
+}
+
+// authorizeSelf writes a 403 and returns false unless the caller is the user
+// being acted on or an admin.
+func authorizeSelf(w http.ResponseWriter, r *http.Request, userId string) bool {
+	principal, ok := auth.FromContext(r.Context())
+	if ok && (principal.Uid == userId || principal.Role == model.RoleAdmin) {
+		return true
+	}
+	apperror.Write(w, r, apperror.Forbidden("you can only modify your own account"))
+	return false
+}
+
+// currentUserClaims returns the token claims of the signed-in user making the
+// request. It writes a 401, or a 403 for API keys, and returns nil if there
+// is no such user.
+func currentUserClaims(w http.ResponseWriter, r *http.Request) *helpers.SignedDetails {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		apperror.Write(w, r, apperror.Unauthorized("authentication required"))
+		return nil
+	}
+	if !principal.IsUser() {
+		apperror.Write(w, r, apperror.Forbidden("this endpoint is only available to signed-in users"))
+		return nil
+	}
+	return principal.Claims
+}
+
+// findUser loads userId, failing with a 404 if there is no such user.
+func (c *Controller) findUser(ctx context.Context, userId string) (*model.User, error) {
+	foundUser, err := c.repos.Users.Get(ctx, userId)
+	if err != nil {
+		return nil, lookupError(err, "user")
+	}
+	return foundUser, nil
+}
+
+func (c *Controller) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+	if !authorizeSelf(w, r, userId) {
+		return
+	}
+
+	var update UserUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(update); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	foundUser, err := c.findUser(ctx, userId)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	var updateObj bson.D
+
+	if update.First_name != nil {
+		updateObj = append(updateObj, bson.E{Key: "first_name", Value: update.First_name})
+	}
+
+	if update.Last_name != nil {
+		updateObj = append(updateObj, bson.E{Key: "last_name", Value: update.Last_name})
+	}
+
+	if update.Phone != nil && (foundUser.Phone == nil || *update.Phone != *foundUser.Phone) {
+		count, err := c.repos.Users.CountByPhone(ctx, *update.Phone)
+		if err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while checking for the phone number", err))
+			return
+		}
+		if count > 0 {
+			apperror.Write(w, r, apperror.Conflict("this phone number already exists"))
+			return
+		}
+		updateObj = append(updateObj, bson.E{Key: "phone", Value: update.Phone})
+	}
+
+	if update.Avatar != nil {
+		updateObj = append(updateObj, bson.E{Key: "avatar", Value: update.Avatar})
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
+
+	updated, err := c.repos.Users.UpdateAndGet(ctx, userId, updateObj)
+	if err != nil {
+		apperror.Write(w, r, updateError(err, "user", "user update failed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newUserAdminView(updated))
+}
+
+// ChangePassword replaces the password of a user given the current one. All
+// of the user's sessions are revoked, so they have to log in again.
+func (c *Controller) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+	if !authorizeSelf(w, r, userId) {
+		return
+	}
+
+	var change PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(change); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	foundUser, err := c.findUser(ctx, userId)
+	if err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	if foundUser.Password == nil {
+		apperror.Write(w, r, apperror.Forbidden("old password is incorrect"))
+		return
+	}
+	if ok, _ := c.passwords.Verify(*change.Old_password, *foundUser.Password); !ok {
+		apperror.Write(w, r, apperror.Forbidden("old password is incorrect"))
+		return
+	}
+
+	if err := c.checkPasswordPolicy(*change.New_password, stringValue(foundUser.Email)); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	password, err := c.passwords.Hash(*change.New_password)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error hashing password", err))
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "password", Value: password},
+		{Key: "token", Value: ""},
+		{Key: "refresh_token", Value: ""},
+		{Key: "updated_at", Value: updated_at},
+	}
+	if _, err := c.repos.Users.Update(ctx, userId, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "password update failed"))
+		return
+	}
+
+	if err := c.revocations.RevokeUser(ctx, userId); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking sessions", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password changed successfully, please log in again"})
+}
+
+// DeactivateUser blocks a user from signing in and ends their sessions,
+// keeping the account and its history. Existing tokens stop working through
+// the revocation list that Authentication consults; they are revoked before
+// the account is marked, so a failed revocation leaves it active rather than
+// deactivated with live tokens.
+func (c *Controller) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+	if !authorizeSelf(w, r, userId) {
+		return
+	}
+
+	if _, err := c.findUser(ctx, userId); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	if err := c.revocations.RevokeUser(ctx, userId); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking sessions", err))
+		return
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "deactivated_at", Value: now},
+		{Key: "token", Value: ""},
+		{Key: "refresh_token", Value: ""},
+		{Key: "updated_at", Value: now},
+	}
+	if _, err := c.repos.Users.Update(ctx, userId, updateObj); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "user deactivation failed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User deactivated successfully"})
+}
+
+// ReactivateUser lets an admin undo DeactivateUser.
+func (c *Controller) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+
+	if _, err := c.findUser(ctx, userId); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "deactivated_at", Value: nil},
+		{Key: "updated_at", Value: updated_at},
+	}
+	updated, err := c.repos.Users.UpdateAndGet(ctx, userId, updateObj)
+	if err != nil {
+		apperror.Write(w, r, updateError(err, "user", "user reactivation failed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newUserAdminView(updated))
+}
+
+func (c *Controller) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+	if !authorizeSelf(w, r, userId) {
+		return
+	}
+
+	result, err := c.repos.Users.Delete(ctx, userId)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while deleting the user", err))
+		return
+	}
+
+	if result.DeletedCount < 1 {
+		apperror.Write(w, r, apperror.NotFound("user with this ID not found"))
+		return
+	}
+
+	if err := c.revocations.RevokeUser(ctx, userId); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking sessions", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
+}
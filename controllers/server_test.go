@@ -0,0 +1,82 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/app"
+	"github.com/datmedevil17/restaurant-management/config"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+)
+
+// newServer returns the full router on top of empty memory repositories.
+func newServer(t *testing.T) (http.Handler, *repository.Repositories) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.JWTSecret = "test secret"
+	cfg.BcryptCost = 4
+	cfg.LogLevel = "error"
+	cfg.NotifyFile = filepath.Join(t.TempDir(), "notifications")
+
+	repos := repository.NewMemory()
+	a, err := app.NewWithRepositories(cfg, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.Router, repos
+}
+
+// call sends a request to h; header holds alternating names and values.
+func call(h http.Handler, method string, path string, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func bearer(token string) []string {
+	return []string{"Authorization", "Bearer " + token}
+}
+
+// decode parses the JSON body of rec, failing the test if it is not JSON.
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not a JSON object: %v: %s", err, rec.Body)
+	}
+	return body
+}
+
+// signUp creates an account and logs it in, returning its id and access
+// token. The first account of a server is its admin.
+func signUp(t *testing.T, h http.Handler, email string, phone string) (string, string) {
+	t.Helper()
+	rec := call(h, "POST", "/users/signup", `{"first_name":"Ada","last_name":"Lovelace","password":"correct horse","email":"`+email+`","phone":"`+phone+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("signup: got %d: %s", rec.Code, rec.Body)
+	}
+	userId, _ := decode(t, rec)["user_id"].(string)
+
+	rec = call(h, "POST", "/users/login", `{"email":"`+email+`","password":"correct horse"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: got %d: %s", rec.Code, rec.Body)
+	}
+	token, _ := decode(t, rec)["token"].(string)
+	return userId, token
+}
+
+// nextSecond waits for the wall clock to enter the next second, so tokens
+// issued afterwards are not covered by revocations made before.
+func nextSecond() {
+	now := time.Now()
+	time.Sleep(now.Truncate(time.Second).Add(time.Second).Sub(now))
+}
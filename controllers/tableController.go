@@ -3,67 +3,72 @@ package controller
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/datmedevil17/restaurant-management/apperror"
 	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func GetTables(w http.ResponseWriter, r *http.Request) {
+// TableUpdate is the body of PUT and PATCH /tables/{table_id}; absent fields
+// are left unchanged.
+type TableUpdate struct {
+	Number_of_guests *int `json:"number_of_guests" validate:"omitnil,min=1"`
+	Table_number     *int `json:"table_number" validate:"omitnil,min=1"`
+}
+
+func (c *Controller) GetTables(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var tables []model.Table
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := tableCollection.Find(context.TODO(), bson.M{})
+	query, err := parseListQuery(r, nil)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing tables"})
+		apperror.Write(w, r, err)
 		return
 	}
-	defer result.Close(ctx)
-	for result.Next(ctx) {
-		var table model.Table
-		if err := result.Decode(&table); err != nil {
-			log.Fatal(err)
-		}
-		tables = append(tables, table)
+
+	tables, err := c.repos.Tables.ListPage(ctx, query)
+	if err != nil {
+		apperror.Write(w, r, listError(err, "tables"))
+		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(tables)
+	json.NewEncoder(w).Encode(newListResponse(tables))
 }
 
-func GetTable(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) GetTable(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	tableId := params["table_id"]
-	var table model.Table
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	err := tableCollection.FindOne(ctx, bson.M{"table_id": tableId}).Decode(&table)
+	table, err := c.repos.Tables.Get(ctx, tableId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while fetching the table"})
+		apperror.Write(w, r, lookupError(err, "table"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(table)
 }
 
-func CreateTable(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) CreateTable(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var table model.Table
 
 	if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(table); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -72,29 +77,75 @@ func CreateTable(w http.ResponseWriter, r *http.Request) {
 	table.ID = primitive.NewObjectID()
 	table.Table_id = table.ID.Hex()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, insertErr := tableCollection.InsertOne(ctx, table)
+	_, insertErr := c.repos.Tables.Create(ctx, table)
 	if insertErr != nil {
 		msg := "table item was not created"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+		apperror.Write(w, r, apperror.Internal(msg, insertErr))
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	w.Header().Set("Location", "/tables/"+table.Table_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(table)
 }
 
-func UpdateTable(w http.ResponseWriter, r *http.Request) {
+// CreateTableAt answers PUT /tables/{table_id} with If-None-Match: *, which
+// creates the table under the id the client picked. A table that already has
+// that id is left alone and the request fails with 412.
+func (c *Controller) CreateTableAt(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	tableId := params["table_id"]
 	var table model.Table
 
 	if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(table); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	table.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	table.ID = primitive.NewObjectID()
+	table.Table_id = tableId
+
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	_, insertErr := c.repos.Tables.Create(ctx, table)
+	if errors.Is(insertErr, repository.ErrDuplicateKey) {
+		apperror.Write(w, r, apperror.PreconditionFailed("table with this ID already exists"))
+		return
+	}
+	if insertErr != nil {
+		msg := "table item was not created"
+		apperror.Write(w, r, apperror.Internal(msg, insertErr))
+		return
+	}
+	w.Header().Set("Location", "/tables/"+table.Table_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(table)
+}
+
+// UpdateTable changes an existing table; a missing one is a 404, never
+// created.
+func (c *Controller) UpdateTable(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := mux.Vars(r)
+	tableId := params["table_id"]
+	var table TableUpdate
+
+	if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(table); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
@@ -108,47 +159,37 @@ func UpdateTable(w http.ResponseWriter, r *http.Request) {
 		updateObj = append(updateObj, bson.E{Key: "table_number", Value: table.Table_number})
 	}
 
-	table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: table.Updated_at})
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	filter := bson.M{"table_id": tableId}
-	upsert := true
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	result, err := tableCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: updateObj}}, &opt)
-
+	updated, err := c.repos.Tables.UpdateAndGet(ctx, tableId, updateObj)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "table update failed"})
+		apperror.Write(w, r, lookupError(err, "table"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(updated)
 }
 
-func DeleteTable(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) DeleteTable(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	params := mux.Vars(r)
 	tableId := params["table_id"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	result, err := tableCollection.DeleteOne(ctx, bson.M{"table_id": tableId})
+	result, err := c.repos.Tables.Delete(ctx, tableId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while deleting the table"})
+		apperror.Write(w, r, apperror.Internal("error occured while deleting the table", err))
 		return
 	}
 
 	if result.DeletedCount < 1 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "table with this ID not found"})
+		apperror.Write(w, r, apperror.NotFound("table with this ID not found"))
 		return
 	}
 
@@ -3,230 +3,688 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/auth"
 	"github.com/datmedevil17/restaurant-management/helpers"
+	"github.com/datmedevil17/restaurant-management/logging"
 	model "github.com/datmedevil17/restaurant-management/models"
-	"github.com/go-playground/validator/v10"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
-var validate = validator.New()
+// UserPublicView is what any signed-in user may see of another.
+type UserPublicView struct {
+	User_id    string  `json:"user_id"`
+	First_name *string `json:"first_name"`
+	Last_name  *string `json:"last_name"`
+	Avatar     *string `json:"avatar"`
+	Role       *string `json:"role"`
+}
 
-func GetUsers(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
+// UserAdminView is what a user sees of themselves and what managers and
+// admins see of everyone. It never carries the password hash or tokens.
+type UserAdminView struct {
+	UserPublicView
+	Email          *string    `json:"email"`
+	Email_verified bool       `json:"email_verified"`
+	Mfa_enabled    bool       `json:"mfa_enabled"`
+	Phone          *string    `json:"phone"`
+	Deactivated_at *time.Time `json:"deactivated_at"`
+	Created_at     time.Time  `json:"created_at"`
+	Updated_at     time.Time  `json:"updated_at"`
+}
 
-	recordPerPage, err := strconv.Atoi(r.URL.Query().Get("recordPerPage"))
-	if err != nil || recordPerPage < 1 {
-		recordPerPage = 10
-	}
+// Credentials is the body of POST /users/login.
+type Credentials struct {
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+}
 
-	page, err1 := strconv.Atoi(r.URL.Query().Get("page"))
-	if err1 != nil || page < 1 {
-		page = 1
-	}
+// RefreshRequest is the body of POST /users/refresh and POST /users/logout.
+type RefreshRequest struct {
+	Refresh_token string `json:"refresh_token"`
+}
 
-	startIndex, _ := strconv.Atoi(r.URL.Query().Get("startIndex"))
+// RoleChange is the body of PUT /users/{user_id}/role.
+type RoleChange struct {
+	Role *string `json:"role" validate:"required,oneof=ADMIN MANAGER WAITER KITCHEN CASHIER"`
+}
 
-	startIndex = (page - 1) * recordPerPage
-	startIndex, _ = strconv.Atoi(r.URL.Query().Get("startIndex"))
+// LoginResponse is the only response that hands out a token pair.
+type LoginResponse struct {
+	UserAdminView
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+}
 
-	matchStage := bson.D{{Key: "$match", Value: bson.D{{}}}}
-	groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "_id", Value: "null"}}}, {Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}}, {Key: "data", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}}}}}
-	projectStage := bson.D{
-		{Key: "$project", Value: bson.D{
-			{Key: "_id", Value: 0},
-			{Key: "total_count", Value: 1},
-			{Key: "user_items", Value: bson.D{{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}}}},
-		}}}
+func newUserPublicView(user *model.User) UserPublicView {
+	return UserPublicView{
+		User_id:    user.User_id,
+		First_name: user.First_name,
+		Last_name:  user.Last_name,
+		Avatar:     user.Avatar,
+		Role:       user.Role,
+	}
+}
 
-	result, err := userCollection.Aggregate(ctx, mongo.Pipeline{
-		matchStage, groupStage, projectStage,
-	})
+func newUserAdminView(user *model.User) UserAdminView {
+	return UserAdminView{
+		UserPublicView: newUserPublicView(user),
+		Email:          user.Email,
+		Email_verified: user.Email_verified,
+		Mfa_enabled:    user.Mfa_enabled,
+		Phone:          user.Phone,
+		Deactivated_at: user.Deactivated_at,
+		Created_at:     user.Created_at,
+		Updated_at:     user.Updated_at,
+	}
+}
 
+func (c *Controller) GetUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	query, err := parseListQuery(r, map[string]string{"role": "role"})
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing users"})
+		apperror.Write(w, r, err)
 		return
 	}
 
-	var allUsers []bson.M
-	if err = result.All(ctx, &allUsers); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+	users, err := c.repos.Users.ListPage(ctx, query)
+	if err != nil {
+		apperror.Write(w, r, listError(err, "users"))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(allUsers[0])
+	json.NewEncoder(w).Encode(newListResponseOf(users, newUserAdminView))
 }
 
-func GetUser(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+func (c *Controller) GetUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
 	params := mux.Vars(r)
 	userId := params["user_id"]
-	var user model.User
 
-	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+	user, err := c.repos.Users.Get(ctx, userId)
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while listing user"})
+		apperror.Write(w, r, lookupError(err, "user"))
+		return
+	}
+
+	// Contact details are for the user themselves and for management.
+	principal, _ := auth.FromContext(r.Context())
+	if principal != nil && (principal.Uid == userId || principal.Role == model.RoleAdmin || principal.Role == model.RoleManager) {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(newUserAdminView(user))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(newUserPublicView(user))
 }
 
-func SignUp(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+func (c *Controller) SignUp(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
 	var user model.User
 
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while decoding the request body"})
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
 		return
 	}
 
-	if validationErr := validate.Struct(user); validationErr != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "validation error"})
+	if err := validateBody(user); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	count, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email})
-	defer cancel()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while checking for the email"})
+	if err := c.checkPasswordPolicy(*user.Password, *user.Email); err != nil {
+		apperror.Write(w, r, err)
 		return
 	}
 
-	password, err := HashPassword(*user.Password)
+	role := model.RoleWaiter
+	if user.Role != nil {
+		role = *user.Role
+	}
+
+	userCount, err := c.repos.Users.Count(ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error hashing password"})
+		apperror.Write(w, r, apperror.Internal("error occured while counting users", err))
 		return
 	}
-	user.Password = &password
 
-	count, err = userCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
-	defer cancel()
+	// The first account on an empty system bootstraps it as its admin; after
+	// that only an admin can hand out privileged roles.
+	if userCount == 0 {
+		role = model.RoleAdmin
+	} else if model.IsPrivilegedRole(role) {
+		apperror.Write(w, r, apperror.Forbidden("privileged roles can only be granted by an admin"))
+		return
+	}
+	user.Role = &role
+
+	count, err := c.repos.Users.CountByEmail(ctx, *user.Email)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error occured while checking for the phone number"})
+		apperror.Write(w, r, apperror.Internal("error occured while checking for the email", err))
+		return
+	}
+	if count > 0 {
+		apperror.Write(w, r, apperror.Conflict("this email already exists"))
 		return
 	}
 
+	count, err = c.repos.Users.CountByPhone(ctx, *user.Phone)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while checking for the phone number", err))
+		return
+	}
 	if count > 0 {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "this email or phone number already exists"})
+		apperror.Write(w, r, apperror.Conflict("this phone number already exists"))
 		return
 	}
 
+	password, err := c.passwords.Hash(*user.Password)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error hashing password", err))
+		return
+	}
+	user.Password = &password
+
 	user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	user.ID = primitive.NewObjectID()
 	user.User_id = user.ID.Hex()
-	token, refreshToken, _ := helpers.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id)
-	user.Token = &token
-	user.Refresh_Token = &refreshToken
-
-	resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
+	// Only VerifyEmail and ConfirmTOTP may set these, whatever the client sent.
+	user.Email_verified = false
+	user.Mfa_enabled = false
+	_, insertErr := c.repos.Users.Create(ctx, user)
 	if insertErr != nil {
 		msg := "User item was not created"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+		apperror.Write(w, r, apperror.Internal(msg, insertErr))
 		return
 	}
-	defer cancel()
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resultInsertionNumber)
+	// The account is usable without a verified email, so a failed delivery
+	// does not undo the signup; the user can ask for a new code.
+	if err := c.sendEmailVerification(ctx, &user); err != nil {
+		logging.FromContext(r.Context()).Warn("sending email verification", "error", err)
+	}
+
+	w.Header().Set("Location", "/users/"+user.User_id)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newUserAdminView(&user))
+}
+
+// loginFailed is the single answer to every bad email/password combination,
+// so callers cannot tell which emails are registered.
+const loginFailed = "invalid email or password"
+
+// clientIP is the address a request came from. Requests relayed by a trusted
+// proxy are attributed to the nearest address in X-Forwarded-For that is not
+// a trusted proxy itself; entries further left may have been made up by the
+// client.
+func (c *Controller) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !c.trustedProxy(host) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip != "" && !c.trustedProxy(ip) {
+			return ip
+		}
+	}
+	return host
+}
+
+func (c *Controller) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
 
-func Login(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+func (c *Controller) Login(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
 
-	var user model.User
-	var foundUser model.User
+	var credentials Credentials
 
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "error reading request"})
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		apperror.Write(w, r, apperror.Validation("error reading request"))
 		return
 	}
 
-	err := userCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&foundUser)
-	defer cancel()
+	if credentials.Email == nil || credentials.Password == nil {
+		apperror.Write(w, r, apperror.Validation("email and password are required"))
+		return
+	}
+
+	ip := c.clientIP(r)
+	retryAfter, err := c.logins.Check(ctx, *credentials.Email, ip)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while checking login attempts", err))
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		apperror.Write(w, r, apperror.TooManyRequests("too many failed login attempts, try again later"))
+		return
+	}
+
+	foundUser, err := c.repos.Users.GetByEmail(ctx, *credentials.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apperror.Write(w, r, apperror.Internal("error occured while looking up the user", err))
+		return
+	}
+
+	storedHash := c.dummyPasswordHash
+	if foundUser != nil && foundUser.Password != nil {
+		storedHash = *foundUser.Password
+	}
+	passwordIsValid, _ := c.passwords.Verify(*credentials.Password, storedHash)
+	if foundUser == nil || !passwordIsValid {
+		if err := c.logins.Fail(ctx, *credentials.Email, ip); err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while recording the login attempt", err))
+			return
+		}
+		apperror.Write(w, r, apperror.Unauthorized(loginFailed))
+		return
+	}
+
+	if err := c.logins.Succeed(ctx, *credentials.Email); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while recording the login attempt", err))
+		return
+	}
+
+	if !foundUser.IsActive() {
+		apperror.Write(w, r, apperror.Forbidden("this account has been deactivated"))
+		return
+	}
+
+	// The password is known right now, so a hash made with an old scheme or
+	// cost can be replaced. Failing to do so only delays the upgrade.
+	if c.passwords.NeedsRehash(storedHash) {
+		if err := c.rehashPassword(ctx, foundUser.User_id, *credentials.Password); err != nil {
+			logging.FromContext(r.Context()).Warn("rehashing password", "error", err)
+		}
+	}
+
+	if foundUser.Mfa_enabled || c.mfaRequired(foundUser) {
+		c.challengeMFA(w, r, foundUser)
+		return
+	}
+
+	c.completeLogin(ctx, w, r, foundUser)
+}
+
+// completeLogin issues a fresh token pair to foundUser once every factor has
+// been checked.
+func (c *Controller) completeLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, foundUser *model.User) {
+	response, err := c.newLogin(ctx, foundUser)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": "email is incorrect"})
+		apperror.Write(w, r, apperror.Internal("error occured while logging in", err))
 		return
 	}
 
-	passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// newLogin starts a session for foundUser and generates and stores its first
+// token pair.
+func (c *Controller) newLogin(ctx context.Context, foundUser *model.User) (*LoginResponse, error) {
+	var role string
+	if foundUser.Role != nil {
+		role = *foundUser.Role
+	}
+
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	session := model.Session{
+		ID:         primitive.NewObjectID(),
+		User_id:    foundUser.User_id,
+		Refresh_id: primitive.NewObjectID().Hex(),
+		Expires_at: now.Add(helpers.RefreshTokenLifetime),
+		Created_at: now,
+		Updated_at: now,
+	}
+	session.Session_id = session.ID.Hex()
+
+	token, refreshToken, err := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, role, session.Session_id, session.Refresh_id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.repos.Sessions.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	err = helpers.UpdateAllTokens(ctx, c.repos.Users, token, refreshToken, foundUser.User_id)
+	if err != nil {
+		return nil, err
+	}
+
+	foundUser, err = c.repos.Users.Get(ctx, foundUser.User_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		UserAdminView: newUserAdminView(foundUser),
+		Token:         token,
+		Refresh_token: refreshToken,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair in the same session.
+// Each refresh token can be used once: presenting one that is no longer the
+// latest of its session is treated as a replay and ends that session, while
+// the user's other sessions carry on.
+func (c *Controller) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
 	defer cancel()
-	if passwordIsValid != true {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg})
+
+	var body RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Refresh_token == "" {
+		apperror.Write(w, r, apperror.Validation("refresh_token is required"))
+		return
+	}
+
+	claims, msg := helpers.ValidateToken(body.Refresh_token)
+	if msg != "" || claims.Token_type != helpers.RefreshToken || claims.Uid == "" {
+		apperror.Write(w, r, apperror.Unauthorized("invalid refresh token"))
+		return
+	}
+	if claims.Session_id == "" {
+		apperror.Write(w, r, apperror.Unauthorized("refresh token is no longer supported, please log in again"))
 		return
 	}
 
-	token, refreshToken, _ := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id)
-	err = helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
+	revoked, err := c.revocations.IsRevoked(ctx, claims)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+		apperror.Write(w, r, apperror.Internal("error occured while checking the refresh token", err))
 		return
 	}
+	if revoked {
+		apperror.Write(w, r, apperror.Unauthorized("refresh token has been revoked, please log in again"))
+		return
+	}
+
+	foundUser, err := c.repos.Users.Get(ctx, claims.Uid)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.Unauthorized("invalid refresh token"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+	if !foundUser.IsActive() {
+		apperror.Write(w, r, apperror.Forbidden("this account has been deactivated"))
+		return
+	}
+
+	var role string
+	if foundUser.Role != nil {
+		role = *foundUser.Role
+	}
 
-	err = userCollection.FindOne(ctx, bson.M{"user_id": foundUser.User_id}).Decode(&foundUser)
+	refreshId := primitive.NewObjectID().Hex()
+	token, refreshToken, err := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id, role, claims.Session_id, refreshId)
+	if err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while generating tokens", err))
+		return
+	}
 
+	rotated, err := c.repos.Sessions.Rotate(ctx, claims.Session_id, claims.ID, refreshId, time.Now().Add(helpers.RefreshTokenLifetime))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+		apperror.Write(w, r, apperror.Internal("error occured while rotating tokens", err))
+		return
+	}
+	if !rotated {
+		// Either the session has ended or the token was already exchanged.
+		// In the second case whoever replayed it may hold tokens issued
+		// from it, so the whole session ends.
+		if err := c.endSession(ctx, foundUser.User_id, claims.Session_id); err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while revoking the session", err))
+			return
+		}
+		apperror.Write(w, r, apperror.Unauthorized("refresh token has already been used, please log in again"))
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(foundUser)
+	json.NewEncoder(w).Encode(map[string]string{"token": token, "refresh_token": refreshToken})
+}
+
+// Logout ends the session the request was made in, revoking its access and
+// refresh tokens, along with the refresh token given in the body, if any, and
+// the user's stored token pair.
+func (c *Controller) Logout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	claims := currentUserClaims(w, r)
+	if claims == nil {
+		return
+	}
+
+	var body RefreshRequest
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if err := c.revocations.Revoke(ctx, claims); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking the token", err))
+		return
+	}
 
+	if body.Refresh_token != "" {
+		refreshClaims, msg := helpers.ValidateToken(body.Refresh_token)
+		if msg == "" && refreshClaims.Uid == claims.Uid {
+			if err := c.revocations.Revoke(ctx, refreshClaims); err != nil {
+				apperror.Write(w, r, apperror.Internal("error occured while revoking the refresh token", err))
+				return
+			}
+		}
+	}
+
+	if claims.Session_id != "" {
+		if err := c.endSession(ctx, claims.Uid, claims.Session_id); err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while revoking the session", err))
+			return
+		}
+	}
+
+	// A user deleted since the token was issued has no stored tokens left.
+	if err := helpers.UpdateAllTokens(ctx, c.repos.Users, "", "", claims.Uid); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		apperror.Write(w, r, apperror.Internal("error occured while clearing stored tokens", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// endSession revokes every token of the session sessionId of userId and
+// forgets the session, so none of its refresh tokens can be exchanged again.
+func (c *Controller) endSession(ctx context.Context, userId string, sessionId string) error {
+	if err := c.revocations.RevokeSession(ctx, userId, sessionId); err != nil {
+		return err
+	}
+	if _, err := c.repos.Sessions.Delete(ctx, sessionId); err != nil {
+		return err
+	}
+	return nil
 }
 
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+// RevokeSessions lets an admin sign a user out everywhere: every token issued
+// to them so far stops being accepted.
+func (c *Controller) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+
+	if _, err := c.repos.Users.Get(ctx, userId); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("user with this ID not found"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+
+	if err := c.revocations.RevokeUser(ctx, userId); err != nil {
+		apperror.Write(w, r, apperror.Internal("error occured while revoking sessions", err))
+		return
+	}
+
+	if err := helpers.UpdateAllTokens(ctx, c.repos.Users, "", "", userId); err != nil {
+		apperror.Write(w, r, updateError(err, "user", "error occured while clearing stored tokens"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "All sessions revoked successfully"})
+}
+
+// UnlockUser lets an admin lift a login lockout of a user ahead of time.
+func (c *Controller) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
+
+	foundUser, err := c.repos.Users.Get(ctx, userId)
 	if err != nil {
-		return "", err
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("user with this ID not found"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
 	}
 
-	return string(bytes), nil
+	if foundUser.Email != nil {
+		if err := c.logins.Unlock(ctx, *foundUser.Email); err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while unlocking the user", err))
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User unlocked successfully"})
 }
 
-func VerifyPassword(userPassword string, providePassword string) (bool, string) {
-	err := bcrypt.CompareHashAndPassword([]byte(providePassword), []byte(userPassword))
-	check := true
-	msg := ""
+// UpdateUserRole lets an admin grant or change the role of another user.
+// Tokens carry the role they were issued with, so a change revokes the
+// user's sessions and takes effect at once; the user logs in again.
+func (c *Controller) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(r.Context(), 100*time.Second)
+	defer cancel()
+
+	userId := mux.Vars(r)["user_id"]
 
+	var body RoleChange
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apperror.Write(w, r, apperror.Validation("error occured while decoding the request body"))
+		return
+	}
+	if err := validateBody(body); err != nil {
+		apperror.Write(w, r, err)
+		return
+	}
+
+	foundUser, err := c.repos.Users.Get(ctx, userId)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			apperror.Write(w, r, apperror.NotFound("user with this ID not found"))
+			return
+		}
+		apperror.Write(w, r, apperror.Internal("error occured while fetching the user", err))
+		return
+	}
+
+	// Sessions are revoked before the role is stored, so a failure leaves
+	// the old role in place rather than live tokens with a stale one.
+	if foundUser.Role == nil || *foundUser.Role != *body.Role {
+		if err := c.revocations.RevokeUser(ctx, userId); err != nil {
+			apperror.Write(w, r, apperror.Internal("error occured while revoking sessions", err))
+			return
+		}
+	}
+
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "role", Value: body.Role},
+		{Key: "updated_at", Value: updated_at},
+	}
+
+	updated, err := c.repos.Users.UpdateAndGet(ctx, userId, updateObj)
 	if err != nil {
-		msg = "login or password is incorrect"
-		check = false
+		apperror.Write(w, r, updateError(err, "user", "user role update failed"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newUserAdminView(updated))
+}
+
+// checkPasswordPolicy returns a validation error, answered with a 400, if
+// password may not be used by the account with the given email.
+func (c *Controller) checkPasswordPolicy(password string, email string) error {
+	if err := c.passwordPolicy.Check(password, email); err != nil {
+		return apperror.Validation(err.Error())
 	}
+	return nil
+}
+
+// rehashPassword stores a fresh hash of password made by the current hasher.
+func (c *Controller) rehashPassword(ctx context.Context, userId string, password string) error {
+	hash, err := c.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = c.repos.Users.Update(ctx, userId, bson.D{{Key: "password", Value: hash}})
+	return err
+}
 
-	return check, msg
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
@@ -0,0 +1,202 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// secretKeys are stored on users but must never be sent back, except for the
+// token pair a login hands out.
+var secretKeys = []string{"password", "token", "refresh_token", "totp_secret", "recovery_codes"}
+
+// findKeys returns the paths of every object member of v named one of keys.
+func findKeys(v interface{}, keys []string, path string) []string {
+	var found []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, member := range v {
+			for _, key := range keys {
+				if name == key {
+					found = append(found, path+"."+name)
+				}
+			}
+			found = append(found, findKeys(member, keys, path+"."+name)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			found = append(found, findKeys(item, keys, path+"[]")...)
+		}
+	}
+	return found
+}
+
+func TestUserResponsesHideSecrets(t *testing.T) {
+	h, _ := newServer(t)
+
+	rec := call(h, "POST", "/users/signup", `{"first_name":"Ada","last_name":"Lovelace","password":"correct horse","email":"ada@example.com","phone":"1"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("signup: got %d: %s", rec.Code, rec.Body)
+	}
+	responses := map[string][]byte{"SignUp": rec.Body.Bytes()}
+	adminId, _ := decode(t, rec)["user_id"].(string)
+
+	rec = call(h, "POST", "/users/login", `{"email":"ada@example.com","password":"correct horse"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login: got %d: %s", rec.Code, rec.Body)
+	}
+	login := decode(t, rec)
+	adminToken, _ := login["token"].(string)
+	if adminToken == "" || login["refresh_token"] == nil {
+		t.Fatalf("login: token pair missing: %s", rec.Body)
+	}
+	// The token pair is the point of a login, but only at the top level.
+	delete(login, "token")
+	delete(login, "refresh_token")
+	if found := findKeys(login, secretKeys, "Login"); len(found) > 0 {
+		t.Errorf("secret fields in response: %v", found)
+	}
+
+	waiterId, waiterToken := signUp(t, h, "grace@example.com", "2")
+
+	for name, request := range map[string][]string{
+		"GetUser (admin view)":  append([]string{"/users/" + adminId}, bearer(adminToken)...),
+		"GetUser (public view)": append([]string{"/users/" + adminId}, bearer(waiterToken)...),
+		"GetUsers":              append([]string{"/users"}, bearer(adminToken)...),
+	} {
+		rec := call(h, "GET", request[0], "", request[1:]...)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", name, rec.Code, rec.Body)
+		}
+		responses[name] = rec.Body.Bytes()
+	}
+	// Updates answer with the user as it now is.
+	for name, request := range map[string][3]string{
+		"UpdateUser":     {"PATCH", "/users/" + adminId, `{"first_name":"Augusta"}`},
+		"UpdateUserRole": {"PUT", "/users/" + waiterId + "/role", `{"role":"MANAGER"}`},
+		"ReactivateUser": {"POST", "/users/" + waiterId + "/reactivate", ""},
+	} {
+		rec := call(h, request[0], request[1], request[2], bearer(adminToken)...)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", name, rec.Code, rec.Body)
+		}
+		if user := decode(t, rec); user["user_id"] == nil {
+			t.Errorf("%s: response is not the user: %s", name, rec.Body)
+		}
+		responses[name] = rec.Body.Bytes()
+	}
+
+	for name, body := range responses {
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if found := findKeys(v, secretKeys, name); len(found) > 0 {
+			t.Errorf("secret fields in response: %v", found)
+		}
+	}
+}
+
+func TestSignUpRejectsDuplicates(t *testing.T) {
+	h, _ := newServer(t)
+	signUp(t, h, "ada@example.com", "1")
+
+	for name, body := range map[string]string{
+		"email": `{"first_name":"Ada","last_name":"Byron","password":"correct horse","email":"ada@example.com","phone":"2"}`,
+		"phone": `{"first_name":"Ada","last_name":"Byron","password":"correct horse","email":"byron@example.com","phone":"1"}`,
+	} {
+		if rec := call(h, "POST", "/users/signup", body); rec.Code != http.StatusConflict {
+			t.Errorf("duplicate %s: got %d, want 409: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestRoleChangeRevokesTokens(t *testing.T) {
+	h, _ := newServer(t)
+	_, adminToken := signUp(t, h, "ada@example.com", "1")
+	managerId, _ := signUp(t, h, "grace@example.com", "2")
+
+	if rec := call(h, "PUT", "/users/"+managerId+"/role", `{"role":"MANAGER"}`, bearer(adminToken)...); rec.Code != http.StatusOK {
+		t.Fatalf("promote: got %d: %s", rec.Code, rec.Body)
+	}
+	// Tokens issued in the second of a revocation are revoked with it.
+	nextSecond()
+	rec := call(h, "POST", "/users/login", `{"email":"grace@example.com","password":"correct horse"}`)
+	managerToken, _ := decode(t, rec)["token"].(string)
+	if rec := call(h, "GET", "/tables", "", bearer(managerToken)...); rec.Code != http.StatusOK {
+		t.Fatalf("manager: got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := call(h, "PUT", "/users/"+managerId+"/role", `{"role":"WAITER"}`, bearer(adminToken)...); rec.Code != http.StatusOK {
+		t.Fatalf("demote: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := call(h, "GET", "/tables", "", bearer(managerToken)...); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token issued before the demotion: got %d, want 401", rec.Code)
+	}
+}
+
+func TestDeactivationRevokesTokens(t *testing.T) {
+	h, _ := newServer(t)
+	_, adminToken := signUp(t, h, "ada@example.com", "1")
+	userId, userToken := signUp(t, h, "grace@example.com", "2")
+
+	if rec := call(h, "POST", "/users/"+userId+"/deactivate", "", bearer(adminToken)...); rec.Code != http.StatusOK {
+		t.Fatalf("deactivate: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := call(h, "GET", "/users/"+userId, "", bearer(userToken)...); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token issued before the deactivation: got %d, want 401", rec.Code)
+	}
+	if rec := call(h, "POST", "/users/login", `{"email":"grace@example.com","password":"correct horse"}`); rec.Code == http.StatusOK {
+		t.Errorf("login after the deactivation: got %d", rec.Code)
+	}
+}
+
+func TestRefreshTokensArePerSession(t *testing.T) {
+	h, _ := newServer(t)
+	userId, _ := signUp(t, h, "ada@example.com", "1")
+	login := func() map[string]interface{} {
+		rec := call(h, "POST", "/users/login", `{"email":"ada@example.com","password":"correct horse"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login: got %d: %s", rec.Code, rec.Body)
+		}
+		return decode(t, rec)
+	}
+	refresh := func(pair map[string]interface{}) *httptest.ResponseRecorder {
+		return call(h, "POST", "/users/refresh", `{"refresh_token":"`+pair["refresh_token"].(string)+`"}`)
+	}
+	get := func(pair map[string]interface{}) int {
+		return call(h, "GET", "/users/"+userId, "", bearer(pair["token"].(string))...).Code
+	}
+
+	laptop, phone := login(), login()
+
+	// A login elsewhere leaves the first session's refresh token usable.
+	rec := refresh(laptop)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh after a second login: got %d: %s", rec.Code, rec.Body)
+	}
+	rotated := decode(t, rec)
+
+	// Replaying the exchanged token ends that session only.
+	if rec := refresh(laptop); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed refresh token: got %d, want 401", rec.Code)
+	}
+	if code := get(rotated); code != http.StatusUnauthorized {
+		t.Errorf("access token of the replayed session: got %d, want 401", code)
+	}
+	if rec := refresh(rotated); rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of the replayed session: got %d, want 401", rec.Code)
+	}
+	if code := get(phone); code != http.StatusOK {
+		t.Errorf("access token of the other session: got %d, want 200", code)
+	}
+
+	// Logging out ends the session, refresh token included.
+	if rec := call(h, "POST", "/users/logout", `{}`, bearer(phone["token"].(string))...); rec.Code != http.StatusOK {
+		t.Fatalf("logout: got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := refresh(phone); rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout: got %d, want 401", rec.Code)
+	}
+}
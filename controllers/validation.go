@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+)
+
+var (
+	validate   = validator.New()
+	translator ut.Translator
+)
+
+func init() {
+	validate.RegisterTagNameFunc(jsonFieldName)
+
+	english := en.New()
+	translator, _ = ut.New(english, english).GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(validate, translator); err != nil {
+		panic(err)
+	}
+	// Marks the field asked for when a patch sets none of the others.
+	err := validate.RegisterTranslation("required_without_all", translator,
+		func(t ut.Translator) error {
+			return t.Add("required_without_all", "{0} is required when no other field is given", true)
+		},
+		func(t ut.Translator, fe validator.FieldError) string {
+			msg, _ := t.T("required_without_all", fe.Field())
+			return msg
+		},
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// jsonFieldName names fields in validation errors as they appear in request
+// bodies.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validateBody checks body against its validate tags. A body that breaks them
+// gives a 422 listing every offending field.
+func validateBody(body interface{}) error {
+	err := validate.Struct(body)
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		if err != nil {
+			return apperror.Internal("error occured while validating the request body", err)
+		}
+		return nil
+	}
+
+	// Namespaces start with the name of the body's type, if it has one.
+	typeName := reflect.Indirect(reflect.ValueOf(body)).Type().Name()
+	fields := make([]apperror.FieldError, len(fieldErrs))
+	for i, fieldErr := range fieldErrs {
+		fields[i] = apperror.FieldError{
+			Field:   strings.TrimPrefix(fieldErr.Namespace(), typeName+"."),
+			Tag:     fieldErr.Tag(),
+			Message: fieldErr.Translate(translator),
+		}
+	}
+	return apperror.Invalid(fields)
+}
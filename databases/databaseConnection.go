@@ -3,39 +3,41 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
 	"time"
 
-	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func DBinstance() *mongo.Client {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	mongoDb := os.Getenv("MONGO_URL")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Connect dials the MongoDB deployment at uri, giving up after timeout.
+// monitor, if not nil, is told about every command the client sends.
+func Connect(ctx context.Context, uri string, timeout time.Duration, monitor *event.CommandMonitor) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoDb))
+	opts := options.Client().ApplyURI(uri)
+	if monitor != nil {
+		opts.SetMonitor(monitor)
+	}
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("connecting to mongo: %w", err)
+	}
+	// Connect does not wait for the deployment, so make sure it answers.
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("pinging mongo: %w", err)
 	}
 
-	fmt.Println("Connected to MongoDB!")
-
-	return client
+	return client, nil
 }
 
-var Client *mongo.Client = DBinstance()
-
-func OpenCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	var collection *mongo.Collection = client.Database("restaurant").Collection(collectionName)
-	return collection
+// Ping checks that the deployment behind client answers, for readiness
+// probes.
+func Ping(client *mongo.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	}
 }
@@ -0,0 +1,26 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// apiKeyPrefixLength is how much of a key is kept in the clear to identify it:
+// "rk_" and the first eight random characters.
+const apiKeyPrefixLength = 11
+
+// NewAPIKey returns a random API key to hand to a client once, along with its
+// prefix and the hash to store in its place.
+func NewAPIKey() (key string, prefix string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = "rk_" + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyPrefixLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the stored form of a key made by NewAPIKey.
+func HashAPIKey(key string) string {
+	return HashUserToken(key)
+}
@@ -0,0 +1,249 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one JWT key. Private is nil for keys that only verify
+// tokens, such as the previous key during a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// KeyProvider hands out the key new tokens are signed with and the keys
+// tokens are accepted from, looked up by their "kid" header.
+type KeyProvider interface {
+	SigningKey() *SigningKey
+	VerificationKey(kid string) (*SigningKey, bool)
+	VerificationKeys() []*SigningKey
+}
+
+// KeySet is a KeyProvider over a fixed set of keys.
+type KeySet struct {
+	signing *SigningKey
+	keys    []*SigningKey
+}
+
+// NewKeySet signs with signing and accepts tokens from it and from every key
+// of verifyOnly.
+func NewKeySet(signing *SigningKey, verifyOnly ...*SigningKey) (*KeySet, error) {
+	if signing == nil || signing.Private == nil {
+		return nil, errors.New("no JWT signing key configured")
+	}
+
+	set := &KeySet{signing: signing}
+	seen := map[string]bool{}
+	for _, key := range append([]*SigningKey{signing}, verifyOnly...) {
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate JWT key id %q", key.ID)
+		}
+		seen[key.ID] = true
+		set.keys = append(set.keys, key)
+	}
+	return set, nil
+}
+
+func (s *KeySet) SigningKey() *SigningKey {
+	return s.signing
+}
+
+// VerificationKey returns the key with the given id. Tokens minted before
+// keys had ids carry none; they were signed with SECRET_KEY, so they are
+// checked against the key with NewHMACKey's default id if there is one, and
+// against the signing key otherwise.
+func (s *KeySet) VerificationKey(kid string) (*SigningKey, bool) {
+	if kid == "" {
+		for _, key := range s.keys {
+			if key.ID == defaultHMACKeyID {
+				return key, true
+			}
+		}
+		return s.signing, true
+	}
+	for _, key := range s.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+func (s *KeySet) VerificationKeys() []*SigningKey {
+	return s.keys
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   KeyProvider
+)
+
+// SetKeyProvider installs the keys GenerateAllTokens and ValidateToken use.
+func SetKeyProvider(p KeyProvider) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	keys = p
+}
+
+func keyProvider() (KeyProvider, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if keys == nil {
+		return nil, errors.New("no JWT signing key configured")
+	}
+	return keys, nil
+}
+
+// defaultHMACKeyID is the id of an HMAC key configured without one.
+const defaultHMACKeyID = "default"
+
+// NewHMACKey returns an HS256 key for secret. kid defaults to "default".
+func NewHMACKey(kid string, secret string) (*SigningKey, error) {
+	if secret == "" {
+		return nil, errors.New("empty JWT secret")
+	}
+	if kid == "" {
+		kid = defaultHMACKeyID
+	}
+	return &SigningKey{ID: kid, Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)}, nil
+}
+
+// LoadKeyFile reads an RSA or Ed25519 key from a PEM file. Private keys can
+// sign and verify, public keys only verify. kid defaults to the key's
+// RFC 7638 thumbprint.
+func LoadKeyFile(kid string, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &SigningKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+	}
+
+	if key.ID == "" {
+		jwk, _ := key.JWK()
+		key.ID = thumbprint(jwk)
+	}
+	return key, nil
+}
+
+// JWK is the public half of a key in JSON Web Key form.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set as served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK describes the public key. HMAC keys are secret and have no JWK form.
+func (k *SigningKey) JWK() (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// thumbprint is the RFC 7638 SHA-256 thumbprint of jwk.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicJWKS lists the public keys tokens are currently accepted from, so
+// other services can verify them without sharing a secret.
+func PublicJWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	p, err := keyProvider()
+	if err != nil {
+		return jwks
+	}
+	for _, key := range p.VerificationKeys() {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
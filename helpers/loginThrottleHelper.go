@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attempts is the failed-login history kept for one account or client.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// AttemptStore keeps failed-login counters. Keys are opaque; counters that
+// have seen no failure for longer than the store's window may be forgotten.
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	RecordFailure(ctx context.Context, key string, at time.Time) (Attempts, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryAttemptStore is an AttemptStore held in process memory.
+type MemoryAttemptStore struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	attempts  map[string]Attempts
+	lastSweep time.Time
+}
+
+func NewMemoryAttemptStore(window time.Duration) *MemoryAttemptStore {
+	return &MemoryAttemptStore{window: window, attempts: map[string]Attempts{}}
+}
+
+func (s *MemoryAttemptStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok || time.Since(a.LastFailure) > s.window {
+		return Attempts{}, nil
+	}
+	return a, nil
+}
+
+func (s *MemoryAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if at.Sub(s.lastSweep) > s.window {
+		for k, a := range s.attempts {
+			if at.Sub(a.LastFailure) > s.window {
+				delete(s.attempts, k)
+			}
+		}
+		s.lastSweep = at
+	}
+
+	a := s.attempts[key]
+	if at.Sub(a.LastFailure) > s.window {
+		a = Attempts{}
+	}
+	a.Failures++
+	a.LastFailure = at
+	s.attempts[key] = a
+	return a, nil
+}
+
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// LoginThrottle slows down password guessing. Every failure doubles the wait
+// before the next attempt, starting at BaseDelay, and after MaxFailures for an
+// account (or IPMaxFailures for a client address) logins are refused for
+// Lockout. Unknown emails are counted like real accounts so lockouts do not
+// reveal which emails exist.
+type LoginThrottle struct {
+	Store         AttemptStore
+	MaxFailures   int
+	IPMaxFailures int
+	BaseDelay     time.Duration
+	Lockout       time.Duration
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// wait is how long after the last failure the next attempt is allowed.
+func (t *LoginThrottle) wait(failures int, max int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+	if failures >= max {
+		return t.Lockout
+	}
+	delay := t.BaseDelay << (failures - 1)
+	if delay <= 0 || delay > t.Lockout {
+		delay = t.Lockout
+	}
+	return delay
+}
+
+// Check returns how long the caller has to wait before email may be tried
+// again from ip; zero means the attempt may go ahead.
+func (t *LoginThrottle) Check(ctx context.Context, email string, ip string) (time.Duration, error) {
+	now := time.Now()
+	var retryAfter time.Duration
+
+	for _, c := range []struct {
+		key string
+		max int
+	}{
+		{accountKey(email), t.MaxFailures},
+		{ipKey(ip), t.IPMaxFailures},
+	} {
+		a, err := t.Store.Get(ctx, c.key)
+		if err != nil {
+			return 0, err
+		}
+		if left := a.LastFailure.Add(t.wait(a.Failures, c.max)).Sub(now); left > retryAfter {
+			retryAfter = left
+		}
+	}
+	return retryAfter, nil
+}
+
+// Fail records a failed attempt for email from ip.
+func (t *LoginThrottle) Fail(ctx context.Context, email string, ip string) error {
+	now := time.Now()
+	if _, err := t.Store.RecordFailure(ctx, accountKey(email), now); err != nil {
+		return err
+	}
+	_, err := t.Store.RecordFailure(ctx, ipKey(ip), now)
+	return err
+}
+
+// Succeed clears the failures of email after a successful login. The client
+// address keeps its count, so one good account cannot launder guesses
+// against others.
+func (t *LoginThrottle) Succeed(ctx context.Context, email string) error {
+	return t.Store.Reset(ctx, accountKey(email))
+}
+
+// Unlock lifts a lockout of email ahead of time.
+func (t *LoginThrottle) Unlock(ctx context.Context, email string) error {
+	return t.Store.Reset(ctx, accountKey(email))
+}
@@ -0,0 +1,235 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher turns passwords into stored hashes and checks them again.
+// Verify accepts a hash made by any supported scheme, so switching hashers
+// does not lock out existing users; NeedsRehash tells which hashes should be
+// replaced the next time the password is known. MaxLength is the most bytes
+// of a password the scheme looks at, or 0 if it reads them all.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (bool, error)
+	NeedsRehash(hash string) bool
+	MaxLength() int
+}
+
+// NewPasswordHasher returns the hasher named by scheme, "bcrypt" or "argon2id".
+func NewPasswordHasher(scheme string, bcryptCost int, argon2Params Argon2Params) (PasswordHasher, error) {
+	switch scheme {
+	case "", "bcrypt":
+		if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost %d is outside %d-%d", bcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return BcryptHasher{Cost: bcryptCost}, nil
+	case "argon2id":
+		if err := argon2Params.validate(); err != nil {
+			return nil, err
+		}
+		return Argon2idHasher{Params: argon2Params}, nil
+	}
+	return nil, fmt.Errorf("unknown password hasher %q, use bcrypt or argon2id", scheme)
+}
+
+// BcryptHasher hashes with bcrypt at Cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+func (h BcryptHasher) Verify(password, hash string) (bool, error) {
+	return verifyPassword(password, hash)
+}
+
+func (h BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// MaxLength is 72, as bcrypt ignores anything past 72 bytes.
+func (h BcryptHasher) MaxLength() int {
+	return 72
+}
+
+// Argon2Params are the argon2id cost settings. Memory is in KiB.
+type Argon2Params struct {
+	Memory  int
+	Time    int
+	Threads int
+}
+
+func (p Argon2Params) validate() error {
+	if p.Memory < 1 || int64(p.Memory) > math.MaxUint32 || p.Time < 1 || int64(p.Time) > math.MaxUint32 || p.Threads < 1 || p.Threads > math.MaxUint8 {
+		return errors.New("argon2id memory and time must be positive and threads within 1-255")
+	}
+	return nil
+}
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2idHasher hashes with argon2id, encoding hashes in the PHC string
+// format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, uint32(h.Params.Time), uint32(h.Params.Memory), uint8(h.Params.Threads), argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Params.Memory, h.Params.Time, h.Params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(password, hash string) (bool, error) {
+	return verifyPassword(password, hash)
+}
+
+func (h Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	return err != nil || params != h.Params || len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+}
+
+// MaxLength is 0: argon2id hashes the whole password.
+func (h Argon2idHasher) MaxLength() int {
+	return 0
+}
+
+// verifyPassword checks password against a hash of any supported scheme.
+func verifyPassword(password, hash string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, uint32(params.Time), uint32(params.Memory), uint8(params.Threads), uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	if err := params.validate(); err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, errors.New("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
+
+// PasswordPolicy decides which new passwords are acceptable. MinLength counts
+// characters while MaxLength counts bytes, as PasswordHasher.MaxLength does.
+// Breached holds lower-cased passwords known from public leaks.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Breached  map[string]struct{}
+}
+
+// Check returns an error describing why password may not be used by the
+// account with the given email, or nil if it may.
+func (p *PasswordPolicy) Check(password, email string) error {
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return fmt.Errorf("password must be at most %d bytes long", p.MaxLength)
+	}
+
+	lower := strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email != "" {
+		local, _, _ := strings.Cut(email, "@")
+		if strings.Contains(lower, email) || (len(local) >= 3 && strings.Contains(lower, local)) {
+			return errors.New("password must not contain your email address")
+		}
+	}
+
+	if _, ok := p.Breached[lower]; ok {
+		return errors.New("this password has appeared in a data breach, please choose another")
+	}
+	return nil
+}
+
+// LoadBreachedPasswords reads a list of leaked passwords, one per line, as
+// used by PasswordPolicy.Breached. Blank lines and lines starting with # are
+// skipped.
+func LoadBreachedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return breached, nil
+}
@@ -0,0 +1,196 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RefreshTokenLifetime is how long a refresh token is valid. It also bounds
+// how long a user-wide revocation has to be kept: no token issued before it
+// can outlive it.
+const RefreshTokenLifetime = 168 * time.Hour
+
+type revocationEntry struct {
+	revoked   *model.RevokedToken
+	cachedTil time.Time
+}
+
+// RevocationList records revoked tokens in a RevocationRepository and keeps
+// recent lookups in memory for ttl, so authenticating a request does not cost
+// a database round trip. Revocations made through this list are visible
+// immediately; ones made by another instance within ttl.
+type RevocationList struct {
+	store repository.RevocationRepository
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	cache     map[string]revocationEntry
+	lastSweep time.Time
+}
+
+func NewRevocationList(store repository.RevocationRepository, ttl time.Duration) *RevocationList {
+	return &RevocationList{store: store, ttl: ttl, cache: map[string]revocationEntry{}}
+}
+
+func userKey(userId string) string {
+	return "user:" + userId
+}
+
+func sessionKey(sessionId string) string {
+	return "session:" + sessionId
+}
+
+// Revoke invalidates the single token described by claims.
+func (l *RevocationList) Revoke(ctx context.Context, claims *SignedDetails) error {
+	if claims.ID == "" {
+		return errors.New("token has no jti claim")
+	}
+	expiresAt := time.Now().Add(RefreshTokenLifetime)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return l.put(ctx, model.RevokedToken{
+		Jti:        claims.ID,
+		User_id:    claims.Uid,
+		Expires_at: expiresAt,
+	})
+}
+
+// RevokeUser invalidates every token issued to userId up to now.
+func (l *RevocationList) RevokeUser(ctx context.Context, userId string) error {
+	now := time.Now()
+	return l.put(ctx, model.RevokedToken{
+		Jti:            userKey(userId),
+		User_id:        userId,
+		Revoked_before: &now,
+		Expires_at:     now.Add(RefreshTokenLifetime),
+	})
+}
+
+// RevokeSession invalidates every token issued up to now in the session
+// sessionId of userId, leaving the user's other sessions alone.
+func (l *RevocationList) RevokeSession(ctx context.Context, userId string, sessionId string) error {
+	now := time.Now()
+	return l.put(ctx, model.RevokedToken{
+		Jti:            sessionKey(sessionId),
+		User_id:        userId,
+		Revoked_before: &now,
+		Expires_at:     now.Add(RefreshTokenLifetime),
+	})
+}
+
+// IsRevoked reports whether the token described by claims was revoked, by its
+// jti, through a revocation of its session, or through a revocation of all
+// of its user's sessions.
+func (l *RevocationList) IsRevoked(ctx context.Context, claims *SignedDetails) (bool, error) {
+	if claims.ID != "" {
+		entry, err := l.get(ctx, claims.ID)
+		if err != nil {
+			return false, err
+		}
+		if entry != nil {
+			return true, nil
+		}
+	}
+
+	if claims.Session_id != "" {
+		entry, err := l.get(ctx, sessionKey(claims.Session_id))
+		if err != nil {
+			return false, err
+		}
+		if issuedBefore(claims, entry) {
+			return true, nil
+		}
+	}
+
+	entry, err := l.get(ctx, userKey(claims.Uid))
+	if err != nil {
+		return false, err
+	}
+	return issuedBefore(claims, entry), nil
+}
+
+// issuedBefore reports whether the token described by claims was issued no
+// later than the Revoked_before of entry.
+func issuedBefore(claims *SignedDetails, entry *model.RevokedToken) bool {
+	if entry == nil || entry.Revoked_before == nil {
+		return false
+	}
+	// JWT timestamps only carry whole seconds; tokens without one predate
+	// the claim and are revoked along with everything else.
+	if claims.IssuedAt == nil {
+		return true
+	}
+	// A token issued earlier in the second of the revocation carries that
+	// second, so every token of that second is revoked; one issued in the
+	// next second is not.
+	return !claims.IssuedAt.Time.After(entry.Revoked_before.Truncate(time.Second))
+}
+
+func (l *RevocationList) put(ctx context.Context, entry model.RevokedToken) error {
+	created_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	updateObj := bson.D{
+		{Key: "user_id", Value: entry.User_id},
+		{Key: "revoked_before", Value: entry.Revoked_before},
+		{Key: "expires_at", Value: entry.Expires_at},
+		{Key: "created_at", Value: created_at},
+	}
+	if _, err := l.store.Update(ctx, entry.Jti, updateObj); err != nil {
+		return err
+	}
+
+	l.remember(entry.Jti, &entry)
+	return nil
+}
+
+func (l *RevocationList) get(ctx context.Context, jti string) (*model.RevokedToken, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	cached, ok := l.cache[jti]
+	l.mu.Unlock()
+	if ok && now.Before(cached.cachedTil) {
+		return live(cached.revoked, now), nil
+	}
+
+	entry, err := l.store.Get(ctx, jti)
+	if errors.Is(err, repository.ErrNotFound) {
+		entry, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.remember(jti, entry)
+	return live(entry, now), nil
+}
+
+func (l *RevocationList) remember(jti string, entry *model.RevokedToken) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > l.ttl {
+		for key, cached := range l.cache {
+			if now.After(cached.cachedTil) {
+				delete(l.cache, key)
+			}
+		}
+		l.lastSweep = now
+	}
+	l.cache[jti] = revocationEntry{revoked: entry, cachedTil: now.Add(l.ttl)}
+}
+
+// live drops entries past their expiry that the store has not yet removed.
+func live(entry *model.RevokedToken, now time.Time) *model.RevokedToken {
+	if entry == nil || now.After(entry.Expires_at) {
+		return nil
+	}
+	return entry
+}
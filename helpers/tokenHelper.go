@@ -2,15 +2,13 @@ package helpers
 
 import (
 	"context"//prevent timeout and db calls from hanging forever
-	"os"
+	"fmt"
 	"time"
 
-	database "github.com/datmedevil17/restaurant-management/databases"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
 	jwt "github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type SignedDetails struct {
@@ -18,36 +16,65 @@ type SignedDetails struct {
 	First_name string
 	Last_name  string
 	Uid        string
+	Role       string
+	Token_type string
+	// Session_id names the login an access or refresh token belongs to.
+	Session_id string
 	jwt.RegisteredClaims
 }
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
-
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+// Values of SignedDetails.Token_type. Tokens minted before the claim existed
+// have no type and are not accepted.
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+	// MFAPendingToken proves a correct password while the second factor is
+	// still outstanding. It only opens the MFA login and enrolment endpoints.
+	MFAPendingToken = "mfa_pending"
+)
 
-func GenerateAllTokens(email string, firstName string, lastName string, uid string) (signedToken string, signedRefreshToken string, err error) {
+// GenerateAllTokens signs an access and refresh token pair for the session
+// sessionId. refreshId becomes the jti of the refresh token, so the session
+// can tell its latest refresh token from earlier ones.
+func GenerateAllTokens(email string, firstName string, lastName string, uid string, role string, sessionId string, refreshId string) (signedToken string, signedRefreshToken string, err error) {
 	claims := &SignedDetails{
 		Email:      email,
 		First_name: firstName,
 		Last_name:  lastName,
 		Uid:        uid,
+		Role:       role,
+		Token_type: AccessToken,
+		Session_id: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Local().Add(time.Hour * time.Duration(24))),
 		},
 	}
 
 	refreshClaims := &SignedDetails{
+		Uid:        uid,
+		Token_type: RefreshToken,
+		Session_id: sessionId,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Local().Add(time.Hour * time.Duration(168))),
+			ID:        refreshId,
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Local().Add(RefreshTokenLifetime)),
 		},
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+	p, err := keyProvider()
+	if err != nil {
+		return
+	}
+	key := p.SigningKey()
+
+	token, err := sign(key, claims)
 	if err != nil {
 		return
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SECRET_KEY))
+	refreshToken, err := sign(key, refreshClaims)
 	if err != nil {
 		return
 	}
@@ -55,10 +82,37 @@ func GenerateAllTokens(email string, firstName string, lastName string, uid stri
 	return token, refreshToken, err
 }
 
-func UpdateAllTokens(signedToken string, signedRefreshToken string, userId string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
+// GenerateMFAPendingToken returns a token of type MFAPendingToken for uid,
+// valid for ttl.
+func GenerateMFAPendingToken(email string, uid string, role string, ttl time.Duration) (string, error) {
+	claims := &SignedDetails{
+		Email:      email,
+		Uid:        uid,
+		Role:       role,
+		Token_type: MFAPendingToken,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	}
+
+	p, err := keyProvider()
+	if err != nil {
+		return "", err
+	}
+	return sign(p.SigningKey(), claims)
+}
 
+func sign(key *SigningKey, claims *SignedDetails) (string, error) {
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+// UpdateAllTokens stores the token pair on the user with userId, returning
+// repository.ErrNotFound if there is no such user.
+func UpdateAllTokens(ctx context.Context, users repository.UserRepository, signedToken string, signedRefreshToken string, userId string) error {
 	var updateObj primitive.D
 
 	updateObj = append(updateObj, bson.E{Key: "token", Value: signedToken})
@@ -67,20 +121,7 @@ func UpdateAllTokens(signedToken string, signedRefreshToken string, userId strin
 	Updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: Updated_at})
 
-	upsert := true
-	filter := bson.M{"user_id": userId}
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
-	}
-
-	_, err := userCollection.UpdateOne(
-		ctx,
-		filter,
-		bson.D{
-			{Key: "$set", Value: updateObj},
-		},
-		&opt,
-	)
+	_, err := users.Update(ctx, userId, updateObj)
 
 	if err != nil {
 		return err
@@ -93,7 +134,19 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 		signedToken,
 		&SignedDetails{},
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(SECRET_KEY), nil
+			p, err := keyProvider()
+			if err != nil {
+				return nil, err
+			}
+			kid, _ := token.Header["kid"].(string)
+			key, ok := p.VerificationKey(kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown signing key %q", kid)
+			}
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+			}
+			return key.Public, nil
 		},
 	)
 
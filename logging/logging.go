@@ -0,0 +1,104 @@
+// Package logging builds the server's slog logger and carries a logger and
+// request id for each request through its context.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// New returns a logger writing JSON in production and text otherwise,
+// dropping records below level ("debug", "info", "warn" or "error").
+func New(w io.Writer, environment string, level string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	if environment == "production" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger of ctx, or slog.Default() if there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the id of the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id of ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Attrs collects attributes that handlers learn while serving a request, such
+// as the authenticated user, for the access log line written once it is done.
+type Attrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type attrsKey struct{}
+
+// WithAttrs returns a copy of ctx carrying attrs.
+func WithAttrs(ctx context.Context, attrs *Attrs) context.Context {
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// AddAttrs records attrs for the access log of the request of ctx. It does
+// nothing outside a request.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if a, ok := ctx.Value(attrsKey{}).(*Attrs); ok {
+		a.mu.Lock()
+		a.attrs = append(a.attrs, attrs...)
+		a.mu.Unlock()
+	}
+}
+
+// List returns the attributes recorded so far.
+func (a *Attrs) List() []slog.Attr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]slog.Attr(nil), a.attrs...)
+}
+
+// maxRequestIDLength bounds the X-Request-ID a client may choose, as it ends
+// up in logs.
+const maxRequestIDLength = 128
+
+// RequestIDFrom returns requested, the X-Request-ID a client sent, if it is
+// short printable ASCII, and a new random id otherwise.
+func RequestIDFrom(requested string) string {
+	if requested != "" && len(requested) <= maxRequestIDLength && !strings.ContainsFunc(requested, func(r rune) bool {
+		return r <= ' ' || r > '~'
+	}) {
+		return requested
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,42 +1,32 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
-	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/datmedevil17/restaurant-management/middlewares"
-	"github.com/datmedevil17/restaurant-management/routes"
-	"github.com/gorilla/mux"
+	"github.com/datmedevil17/restaurant-management/app"
+	"github.com/datmedevil17/restaurant-management/config"
 )
 
-
-// helper for client.DatabaseName("").collection(collectionName)
-
-
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	r := mux.NewRouter()
-	r.Use(middlewares.Logger)
-
-	routes.UserRoutes(r)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	api := r.PathPrefix("/").Subrouter()
-	api.Use(middlewares.Authentication)
-
-	routes.UserProtectedRoutes(api)
-	routes.FoodRoutes(api)
-	routes.MenuRoutes(api)
-	routes.OrderRoutes(api)
-	routes.OrderItemRoutes(api)
-	routes.TableRoutes(api)
-	routes.InvoiceRoutes(api)
-
-	log.Println("Server running on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	a, err := app.New(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	a.Logger.Info("server running", "port", cfg.Port, "environment", cfg.Environment)
+	if err := a.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	a.Logger.Info("server stopped")
 }
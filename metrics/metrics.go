@@ -0,0 +1,87 @@
+// Package metrics holds the Prometheus metrics of the server and serves them
+// in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric below along with the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// HTTP metrics are labelled by the mux path template of the route, such as
+// /orders/{order_id}, so that ids do not multiply the series.
+var (
+	httpRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being served.",
+	})
+)
+
+// ObserveRequest records a served HTTP request.
+func ObserveRequest(method string, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+var mongoCommandDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "mongodb_command_duration_seconds",
+	Help:    "Time taken by MongoDB commands, by command name and outcome.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"command", "outcome"})
+
+// Business metrics.
+var (
+	OrdersCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "restaurant_orders_created_total",
+		Help: "Orders created.",
+	})
+
+	ItemsOrdered = factory.NewCounter(prometheus.CounterOpts{
+		Name: "restaurant_items_ordered_total",
+		Help: "Order items created.",
+	})
+
+	InvoicesPaid = factory.NewCounter(prometheus.CounterOpts{
+		Name: "restaurant_invoices_paid_total",
+		Help: "Invoices marked as paid.",
+	})
+
+	Revenue = factory.NewCounter(prometheus.CounterOpts{
+		Name: "restaurant_revenue_total",
+		Help: "Sum of the amounts due on invoices marked as paid.",
+	})
+)
+
+// Handler serves Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
@@ -1,41 +1,152 @@
 package middlewares
 
 import (
-	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/auth"
 	"github.com/datmedevil17/restaurant-management/helpers"
+	"github.com/datmedevil17/restaurant-management/logging"
+	model "github.com/datmedevil17/restaurant-management/models"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
-func Authentication(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientToken := r.Header.Get("token")
-		if clientToken == "" {
-			w.WriteHeader(http.StatusInternalServerError) //500
-			json.NewEncoder(w).Encode(map[string]string{"message": "No Authorization header provided"})
-			return
-		}
+const realm = "restaurant"
 
-		claims, msg := helpers.ValidateToken(clientToken)
-		if msg != "" {
-			w.WriteHeader(http.StatusInternalServerError) //500
-			json.NewEncoder(w).Encode(map[string]string{"message": msg})
-			return
+// bearerToken returns the token of an "Authorization: Bearer" header, falling
+// back to the legacy "token" header.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
 		}
+		return ""
+	}
+	return r.Header.Get("token")
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge string, msg string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	apperror.Write(w, r, apperror.Unauthorized(msg))
+}
+
+// apiKeyTouchInterval is how stale an API key's last-used time may get before
+// it is written again, so busy clients do not cost a write per request.
+const apiKeyTouchInterval = time.Minute
+
+// Authentication rejects requests without a valid, unrevoked access token or
+// a usable X-API-Key, and makes the caller available through
+// auth.FromContext.
+func Authentication(revocations *helpers.RevocationList, apiKeys repository.APIKeyRepository) func(http.Handler) http.Handler {
+	withToken := AuthenticationFor(revocations, helpers.AccessToken)
+	return func(next http.Handler) http.Handler {
+		tokenHandler := withToken(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("X-API-Key")
+			if key == "" {
+				tokenHandler.ServeHTTP(w, r)
+				return
+			}
+
+			apiKey, err := apiKeys.GetByHash(r.Context(), helpers.HashAPIKey(key))
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				apperror.Write(w, r, apperror.Internal("error occured while checking the api key", err))
+				return
+			}
+			now := time.Now()
+			if apiKey == nil || !apiKey.IsUsable(now) {
+				unauthorized(w, r, fmt.Sprintf("APIKey realm=%q", realm), "api key is invalid, expired or revoked")
+				return
+			}
 
-		r.Header.Set("email", claims.Email)
-		r.Header.Set("first_name", claims.First_name)
-		r.Header.Set("last_name", claims.Last_name)
-		r.Header.Set("uid", claims.Uid)
+			method, template := r.Method, ""
+			if route := mux.CurrentRoute(r); route != nil {
+				template, _ = route.GetPathTemplate()
+			}
+			if !apiKey.AllowsRoute(method, template) {
+				apperror.Write(w, r, apperror.Forbidden("this api key may not call this route"))
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
+			if apiKey.Last_used_at == nil || now.Sub(*apiKey.Last_used_at) > apiKeyTouchInterval {
+				if _, err := apiKeys.Update(r.Context(), apiKey.Api_key_id, bson.D{{Key: "last_used_at", Value: now}}); err != nil {
+					logging.FromContext(r.Context()).Warn("recording api key use", "error", err)
+				}
+			}
+
+			logging.AddAttrs(r.Context(), slog.String("api_key_id", apiKey.Api_key_id))
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), auth.NewAPIKeyPrincipal(apiKey))))
+		})
+	}
+}
+
+// AuthenticationFor only accepts JWTs, of any of tokenTypes. Tokens without a
+// type or a user predate both claims and are refused: among them are old
+// refresh tokens, which must not pass as access tokens.
+func AuthenticationFor(revocations *helpers.RevocationList, tokenTypes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientToken := bearerToken(r)
+			if clientToken == "" {
+				unauthorized(w, r, fmt.Sprintf("Bearer realm=%q", realm), "No Authorization header provided")
+				return
+			}
+
+			claims, msg := helpers.ValidateToken(clientToken)
+			if msg == "" {
+				switch {
+				case claims.Token_type == "" || claims.Uid == "":
+					msg = "token is no longer supported, please log in again"
+				case !slices.Contains(tokenTypes, claims.Token_type):
+					msg = fmt.Sprintf("%s tokens cannot be used to authenticate this request", claims.Token_type)
+				}
+			}
+			if msg == "" {
+				revoked, err := revocations.IsRevoked(r.Context(), claims)
+				if err != nil {
+					apperror.Write(w, r, apperror.Internal("error occured while checking the token", err))
+					return
+				}
+				if revoked {
+					msg = "token has been revoked"
+				}
+			}
+			if msg != "" {
+				unauthorized(w, r, fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\", error_description=%q", realm, msg), msg)
+				return
+			}
+
+			logging.AddAttrs(r.Context(), slog.String("user_id", claims.Uid))
+			next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), auth.NewUserPrincipal(claims))))
+		})
+	}
 }
 
-func Logger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Request: %s %s", r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
-	})
+// RequireRole only lets requests through whose authenticated user holds one
+// of roles; admins are always let through. It must run after Authentication.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.FromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, fmt.Sprintf("Bearer realm=%q", realm), "authentication required")
+				return
+			}
+			if principal.Role == model.RoleAdmin || slices.Contains(roles, principal.Role) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			apperror.Write(w, r, apperror.Forbidden("you do not have permission to perform this action"))
+		})
+	}
 }
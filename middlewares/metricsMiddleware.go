@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/metrics"
+)
+
+// Metrics counts requests and their latency by route template, and tracks
+// how many are in flight.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics.HTTPInFlight.Inc()
+		defer metrics.HTTPInFlight.Dec()
+
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		metrics.ObserveRequest(r.Method, routeTemplate(r), recorder.Status(), time.Since(start))
+	})
+}
@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	"github.com/datmedevil17/restaurant-management/logging"
+)
+
+// Recoverer turns a panicking handler into a 500 for that request alone,
+// logging the panic with its stack, instead of letting it take down the
+// server. If the response had already started, the panic is only logged.
+// http.ErrAbortHandler is re-panicked as net/http expects.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			err := fmt.Errorf("panic: %v\n%s", rec, debug.Stack())
+			if recorder.status != 0 {
+				logging.FromContext(r.Context()).Error("panic after the response started",
+					"method", r.Method, "path", r.URL.Path, "error", err)
+				return
+			}
+			apperror.Write(w, r, apperror.Internal("internal server error", err))
+		}()
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/datmedevil17/restaurant-management/logging"
+)
+
+func TestRecovererAnswersPanicsWith500(t *testing.T) {
+	var logs bytes.Buffer
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req = req.WithContext(logging.NewContext(req.Context(), slog.New(slog.NewTextHandler(&logs, nil))))
+	rec := httptest.NewRecorder()
+
+	Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want 500", rec.Code)
+	}
+	var problem struct {
+		Status int    `json:"status"`
+		Detail string `json:"detail"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil || problem.Status != http.StatusInternalServerError {
+		t.Errorf("body is not a 500 problem document: %s", rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "boom") {
+		t.Errorf("panic value leaked to the client: %s", rec.Body)
+	}
+	if !strings.Contains(logs.String(), "panic: boom") || !strings.Contains(logs.String(), "recoverMiddleware_test.go") {
+		t.Errorf("panic was not logged with its stack: %s", logs.String())
+	}
+}
+
+func TestRecovererRepanicsAbortHandler(t *testing.T) {
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("got %v, want http.ErrAbortHandler to propagate", rec)
+		}
+	}()
+	Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestRecovererKeepsAStartedResponse(t *testing.T) {
+	var logs bytes.Buffer
+	req := httptest.NewRequest("GET", "/orders", nil)
+	req = req.WithContext(logging.NewContext(req.Context(), slog.New(slog.NewTextHandler(&logs, nil))))
+	rec := httptest.NewRecorder()
+
+	Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"items":[`))
+		panic("boom")
+	})).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"items":[` {
+		t.Errorf("started response was changed: %d %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(logs.String(), "panic: boom") {
+		t.Errorf("panic was not logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey lets a machine client, such as a kitchen display, call the API as
+// Role without a user account. Only the SHA-256 of the key is stored; Prefix
+// is its first characters, kept to tell keys apart. Routes, if set, limits
+// the key to those routes, each a mux path template optionally preceded by a
+// method, e.g. "GET /orders/{order_id}".
+type APIKey struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Name         *string            `json:"name" validate:"required,min=2,max=100" bson:"name"`
+	Prefix       string             `json:"prefix" bson:"prefix"`
+	Key_hash     string             `json:"-" bson:"key_hash"`
+	Role         *string            `json:"role" validate:"required,oneof=MANAGER WAITER KITCHEN CASHIER" bson:"role"`
+	Routes       []string           `json:"routes" validate:"dive,required" bson:"routes"`
+	Expires_at   *time.Time         `json:"expires_at" bson:"expires_at"`
+	Last_used_at *time.Time         `json:"last_used_at" bson:"last_used_at"`
+	Revoked_at   *time.Time         `json:"revoked_at" bson:"revoked_at"`
+	Created_by   string             `json:"created_by" bson:"created_by"`
+	Created_at   time.Time          `json:"created_at" bson:"created_at"`
+	Updated_at   time.Time          `json:"updated_at" bson:"updated_at"`
+	Api_key_id   string             `json:"api_key_id" bson:"api_key_id"`
+}
+
+// IsUsable reports whether the key is neither revoked nor expired at now.
+func (k *APIKey) IsUsable(now time.Time) bool {
+	return k.Revoked_at == nil && (k.Expires_at == nil || now.Before(*k.Expires_at))
+}
+
+// AllowsRoute reports whether the key may call the route with the given
+// method and path template.
+func (k *APIKey) AllowsRoute(method string, template string) bool {
+	if len(k.Routes) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(k.Routes, func(route string) bool {
+		if m, path, ok := strings.Cut(route, " "); ok {
+			return strings.EqualFold(m, method) && path == template
+		}
+		return route == template
+	})
+}
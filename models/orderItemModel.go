@@ -8,7 +8,7 @@ import (
 
 type OrderItem struct {
 	ID            primitive.ObjectID `bson:"_id" json:"_id"`
-	Quantity      *string            `json:"quantity" validate:"required,eq=S|eq=M|eq=L" bson:"quantity"`
+	Quantity      *string            `json:"quantity" validate:"required,oneof=S M L" bson:"quantity"`
 	Unit_price    *float64           `json:"unit_price" validate:"required" bson:"unit_price"`
 	Created_at    time.Time          `json:"created_at" bson:"created_at"`
 	Updated_at    time.Time          `json:"updated_at" bson:"updated_at"`
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RevokedToken is an entry of the token revocation list, keyed by the JWT id.
+// Entries covering every session of a user are keyed "user:<user_id>" and set
+// Revoked_before instead. Either kind is kept until Expires_at, after which
+// the tokens it covers would have expired anyway.
+type RevokedToken struct {
+	ID             primitive.ObjectID `bson:"_id" json:"_id"`
+	Jti            string             `json:"jti" bson:"jti"`
+	User_id        string             `json:"user_id" bson:"user_id"`
+	Revoked_before *time.Time         `json:"revoked_before" bson:"revoked_before"`
+	Expires_at     time.Time          `json:"expires_at" bson:"expires_at"`
+	Created_at     time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one login of a user and the chain of refresh tokens that follow
+// from it. Refresh_id is the jti of the latest refresh token; only that one
+// may be exchanged, and presenting an earlier one ends the session. Sessions
+// are removed once Expires_at, the expiry of their latest refresh token,
+// passes.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id" json:"_id"`
+	Session_id string             `json:"session_id" bson:"session_id"`
+	User_id    string             `json:"user_id" bson:"user_id"`
+	Refresh_id string             `json:"refresh_id" bson:"refresh_id"`
+	Expires_at time.Time          `json:"expires_at" bson:"expires_at"`
+	Created_at time.Time          `json:"created_at" bson:"created_at"`
+	Updated_at time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -7,16 +7,42 @@ import (
 )
 
 type User struct {
-	ID            primitive.ObjectID `bson:"_id"`
-	First_name    *string            `json:"first_name" validate:"required,min=2,max=100" bson:"first_name"`
-	Last_name     *string            `json:"last_name" validate:"required,min=2,max=100" bson:"last_name"`
-	Password      *string            `json:"password" validate:"required,min=6" bson:"password"`
-	Email         *string            `json:"email" validate:"email,required" bson:"email"`
-	Avatar        *string            `json:"avatar" bson:"avatar"`
-	Phone         *string            `json:"phone" validate:"required" bson:"phone"`
-	Token         *string            `json:"token" bson:"token"`
-	Refresh_Token *string            `json:"refresh_token" bson:"refresh_token"`
-	Created_at    time.Time          `json:"created_at" bson:"created_at"`
-	Updated_at    time.Time          `json:"updated_at" bson:"updated_at"`
-	User_id       string             `json:"user_id" bson:"user_id"`
+	ID             primitive.ObjectID `bson:"_id"`
+	First_name     *string            `json:"first_name" validate:"required,min=2,max=100" bson:"first_name"`
+	Last_name      *string            `json:"last_name" validate:"required,min=2,max=100" bson:"last_name"`
+	Password       *string            `json:"password" validate:"required" bson:"password"`
+	Email          *string            `json:"email" validate:"email,required" bson:"email"`
+	Email_verified bool               `json:"email_verified" bson:"email_verified"`
+	Avatar         *string            `json:"avatar" bson:"avatar"`
+	Phone          *string            `json:"phone" validate:"required" bson:"phone"`
+	Role           *string            `json:"role" validate:"omitempty,oneof=ADMIN MANAGER WAITER KITCHEN CASHIER" bson:"role"`
+	Token          *string            `json:"token" bson:"token"`
+	Refresh_Token  *string            `json:"refresh_token" bson:"refresh_token"`
+	Deactivated_at *time.Time         `json:"deactivated_at" bson:"deactivated_at"`
+	Mfa_enabled    bool               `json:"mfa_enabled" bson:"mfa_enabled"`
+	Totp_secret    *string            `json:"-" bson:"totp_secret"`
+	Totp_last_step int64              `json:"-" bson:"totp_last_step"`
+	Recovery_codes []string           `json:"-" bson:"recovery_codes"`
+	Created_at     time.Time          `json:"created_at" bson:"created_at"`
+	Updated_at     time.Time          `json:"updated_at" bson:"updated_at"`
+	User_id        string             `json:"user_id" bson:"user_id"`
+}
+
+// IsActive reports whether the user may sign in.
+func (u *User) IsActive() bool {
+	return u.Deactivated_at == nil
+}
+
+// Staff roles a user can hold. ADMIN passes every role check.
+const (
+	RoleAdmin   = "ADMIN"
+	RoleManager = "MANAGER"
+	RoleWaiter  = "WAITER"
+	RoleKitchen = "KITCHEN"
+	RoleCashier = "CASHIER"
+)
+
+// IsPrivilegedRole reports whether role may only be granted by an admin.
+func IsPrivilegedRole(role string) bool {
+	return role == RoleAdmin || role == RoleManager
 }
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of a UserToken.
+const (
+	PasswordResetToken     = "password_reset"
+	EmailVerificationToken = "email_verification"
+)
+
+// UserToken is a single-use code sent to a user, such as a password reset
+// link. Only the SHA-256 of the code is stored.
+type UserToken struct {
+	ID         primitive.ObjectID `bson:"_id" json:"_id"`
+	Token_hash string             `json:"token_hash" bson:"token_hash"`
+	User_id    string             `json:"user_id" bson:"user_id"`
+	Purpose    string             `json:"purpose" bson:"purpose"`
+	Expires_at time.Time          `json:"expires_at" bson:"expires_at"`
+	Used_at    *time.Time         `json:"used_at" bson:"used_at"`
+	Created_at time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,212 @@
+// Package openapi describes the HTTP API as an OpenAPI 3.1 document. Schemas
+// are generated from the request and response types the controllers use, so
+// they follow the structs; the routes themselves are listed in spec.go and
+// checked against the router by Undocumented.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags"`
+	Security    []map[string][]string `json:"security"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Operation looks up the operation for method on the path template, or nil.
+func (d *Document) Operation(method string, template string) *Operation {
+	return d.Paths[template][strings.ToLower(method)]
+}
+
+// Undocumented walks router and returns "METHOD /template" for every route
+// the document has no operation for.
+func (d *Document) Undocumented(router *mux.Router) ([]string, error) {
+	var missing []string
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters and other routes without methods serve nothing
+			// themselves.
+			return nil
+		}
+		for _, method := range methods {
+			if d.Operation(method, template) == nil {
+				missing = append(missing, method+" "+template)
+			}
+		}
+		return nil
+	})
+	sort.Strings(missing)
+	return missing, err
+}
+
+var pathParameter = regexp.MustCompile(`\{([^}]+)\}`)
+
+// builder collects operations and the schemas they refer to.
+type builder struct {
+	doc *Document
+	gen *generator
+}
+
+// op describes one operation. body and response are values of the types
+// read and written, or nil when there is no body.
+type op struct {
+	method   string
+	path     string
+	tag      string
+	summary  string
+	public   bool
+	query    []*Parameter
+	body     interface{}
+	status   int
+	response interface{}
+	// content overrides the media type of response, which defaults to JSON.
+	content string
+}
+
+func (b *builder) schema(v interface{}) *Schema {
+	if s, ok := v.(*Schema); ok {
+		return s
+	}
+	return b.gen.schemaOf(reflect.TypeOf(v))
+}
+
+func (b *builder) add(o op) {
+	operation := &Operation{
+		OperationID: operationID(o.method, o.path),
+		Summary:     o.summary,
+		Tags:        []string{o.tag},
+		Security:    []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}},
+		Parameters:  o.query,
+		Responses: map[string]*Response{
+			"default": {
+				Description: "The request failed.",
+				Content:     map[string]*MediaType{"application/problem+json": {Schema: b.schema(Problem{})}},
+			},
+		},
+	}
+	if o.public {
+		operation.Security = []map[string][]string{}
+	}
+	for _, match := range pathParameter.FindAllStringSubmatch(o.path, -1) {
+		operation.Parameters = append([]*Parameter{{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		}}, operation.Parameters...)
+	}
+	if o.body != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: b.schema(o.body)}},
+		}
+	}
+
+	status := o.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	operation.Responses[strconv.Itoa(status)] = b.response(status, o.content, o.response)
+
+	if b.doc.Paths[o.path] == nil {
+		b.doc.Paths[o.path] = map[string]*Operation{}
+	}
+	b.doc.Paths[o.path][strings.ToLower(o.method)] = operation
+}
+
+// response describes a response with status whose body is v sent as content,
+// JSON by default; v is nil when there is no body.
+func (b *builder) response(status int, content string, v interface{}) *Response {
+	response := &Response{Description: http.StatusText(status)}
+	if status == http.StatusCreated {
+		response.Headers = map[string]*Header{
+			"Location": {Description: "Path of the created resource.", Schema: &Schema{Type: "string"}},
+		}
+	}
+	if v != nil {
+		if content == "" {
+			content = "application/json"
+		}
+		response.Content = map[string]*MediaType{content: {Schema: b.schema(v)}}
+	}
+	return response
+}
+
+// operationID names an operation after its method and path, e.g.
+// "get_orders_order_id" for GET /orders/{order_id}.
+func operationID(method string, path string) string {
+	id := strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_", ".", "").Replace(path)
+	return strings.TrimSuffix(id, "_")
+}
@@ -0,0 +1,348 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/restaurant-management/app"
+	"github.com/datmedevil17/restaurant-management/config"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	"github.com/datmedevil17/restaurant-management/openapi"
+	repository "github.com/datmedevil17/restaurant-management/repositories"
+	"github.com/gorilla/mux"
+)
+
+// client sends requests to the full router on top of memory repositories
+// and checks every response against the document the router serves.
+type client struct {
+	t             *testing.T
+	router        *mux.Router
+	doc           openapi.Document
+	notifications string
+	// exercised holds "METHOD /template" for every route that has given
+	// the success response it was asked for.
+	exercised map[string]bool
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	cfg := config.Default()
+	cfg.JWTSecret = "test secret"
+	cfg.BcryptCost = 4
+	cfg.LogLevel = "error"
+	cfg.NotifyFile = filepath.Join(t.TempDir(), "notifications")
+	// Every request comes from the same address, which would otherwise have
+	// to wait a second between the mails the scenario asks for.
+	cfg.LoginBackoff = time.Millisecond
+
+	a, err := app.NewWithRepositories(cfg, repository.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &client{t: t, router: a.Router, notifications: cfg.NotifyFile, exercised: map[string]bool{}}
+
+	rec := httptest.NewRecorder()
+	a.Router.ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: got %d", rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &c.doc); err != nil {
+		t.Fatalf("GET /openapi.json: %v", err)
+	}
+	return c
+}
+
+// routes walks the router and returns "METHOD /template" for every route
+// that serves requests.
+func routes(t *testing.T, router *mux.Router) []string {
+	t.Helper()
+	var found []string
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			found = append(found, method+" "+template)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(found)
+	return found
+}
+
+// do sends a request, fails the test unless it is answered with status as
+// the document describes, and returns the body if it is a JSON object.
+// header holds alternating names and values.
+func (c *client) do(status int, method string, path string, body string, token string, header ...string) map[string]interface{} {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+
+	var match mux.RouteMatch
+	if !c.router.Match(req, &match) {
+		c.t.Errorf("%s %s: no route", method, path)
+		return nil
+	}
+	template, _ := match.Route.GetPathTemplate()
+	name := method + " " + template
+	if rec.Code != status {
+		c.t.Errorf("%s: got %d, want %d: %s", name, rec.Code, status, rec.Body)
+	} else if status < http.StatusBadRequest {
+		c.exercised[name] = true
+	}
+
+	operation := c.doc.Operation(method, template)
+	if operation == nil {
+		c.t.Errorf("%s is not documented", name)
+		return nil
+	}
+	response := operation.Responses[strconv.Itoa(rec.Code)]
+	if response == nil && rec.Code >= http.StatusBadRequest {
+		response = operation.Responses["default"]
+	}
+	if response == nil {
+		c.t.Errorf("%s: status %d is not documented", name, rec.Code)
+		return nil
+	}
+	c.check(name, response, rec)
+
+	var decoded map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &decoded)
+	return decoded
+}
+
+// check compares the headers, media type and body of rec with response.
+func (c *client) check(name string, response *openapi.Response, rec *httptest.ResponseRecorder) {
+	c.t.Helper()
+	for header := range response.Headers {
+		if rec.Header().Get(header) == "" {
+			c.t.Errorf("%s: %d has no %s header", name, rec.Code, header)
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	content := response.Content[mediaType]
+	if err != nil || content == nil {
+		c.t.Errorf("%s: %d with Content-Type %q is not documented", name, rec.Code, rec.Header().Get("Content-Type"))
+		return
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return
+	}
+	var body interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		c.t.Errorf("%s: %d is not JSON: %v", name, rec.Code, err)
+		return
+	}
+	for _, problem := range validate(&c.doc, content.Schema, body, "body") {
+		c.t.Errorf("%s: %d: %s", name, rec.Code, problem)
+	}
+}
+
+func (c *client) signUp(email string, phone string) string {
+	c.t.Helper()
+	user := c.do(http.StatusCreated, "POST", "/users/signup",
+		`{"first_name":"Ada","last_name":"Lovelace","password":"correct horse","email":"`+email+`","phone":"`+phone+`"}`, "")
+	return str(user, "user_id")
+}
+
+func (c *client) logIn(status int, email string, password string) map[string]interface{} {
+	c.t.Helper()
+	return c.do(status, "POST", "/users/login", `{"email":"`+email+`","password":"`+password+`"}`, "")
+}
+
+// code returns the code sent in the last notification with subject, waiting
+// for it since some are sent after the response.
+func (c *client) code(subject string) string {
+	c.t.Helper()
+	var messages []string
+	for deadline := time.Now().Add(5 * time.Second); len(messages) < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			c.t.Fatalf("no %q notification", subject)
+		}
+		notifications, err := os.ReadFile(c.notifications)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.t.Fatal(err)
+		}
+		messages = strings.Split(string(notifications), "Subject: "+subject+"\n\n")
+	}
+	line, _, _ := strings.Cut(messages[len(messages)-1], "\n")
+	_, code, _ := strings.Cut(line, ": ")
+	return code
+}
+
+func totp(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := helpers.TOTPCode(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func str(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	c := newClient(t)
+
+	routed := map[string]bool{}
+	for _, route := range routes(t, c.router) {
+		routed[route] = true
+		method, template, _ := strings.Cut(route, " ")
+		if c.doc.Operation(method, template) == nil {
+			t.Errorf("%s is missing from /openapi.json", route)
+		}
+	}
+	for template, operations := range c.doc.Paths {
+		for method := range operations {
+			if route := strings.ToUpper(method) + " " + template; !routed[route] {
+				t.Errorf("%s is documented but not routed", route)
+			}
+		}
+	}
+}
+
+// Every route is driven to its documented success response, and a few to
+// their errors, with each answer checked against the document.
+func TestResponsesMatchTheDocument(t *testing.T) {
+	c := newClient(t)
+	const ok, created, accepted = http.StatusOK, http.StatusCreated, http.StatusAccepted
+
+	for _, path := range []string{"/healthz", "/readyz", "/version", "/.well-known/jwks.json", "/openapi.json", "/docs"} {
+		c.do(ok, "GET", path, "", "")
+	}
+
+	// The first account is the admin everything else is done as.
+	adminId := c.signUp("ada@example.com", "1")
+	login := c.logIn(ok, "ada@example.com", "correct horse")
+	pair := c.do(ok, "POST", "/users/refresh", `{"refresh_token":"`+str(login, "refresh_token")+`"}`, "")
+	admin := str(pair, "token")
+	c.do(accepted, "POST", "/users/email/resend", "", admin)
+	c.do(ok, "POST", "/users/email/verify", `{"token":"`+c.code("Verify your email address")+`"}`, "")
+	c.do(ok, "GET", "/users", "", admin)
+	c.do(ok, "GET", "/users/"+adminId, "", admin)
+	c.do(http.StatusUnauthorized, "GET", "/users", "", "")
+	c.do(http.StatusBadRequest, "GET", "/users?cursor=junk", "", admin)
+	c.do(ok, "GET", "/metrics", "", admin)
+	c.do(http.StatusUnauthorized, "GET", "/metrics", "", "")
+
+	// Enrol a second factor, log in with it and turn it off again.
+	mfaId := c.signUp("grace@example.com", "2")
+	mfa := str(c.logIn(ok, "grace@example.com", "correct horse"), "token")
+	secret := str(c.do(ok, "POST", "/users/mfa/totp/setup", "", mfa), "secret")
+	now := time.Now()
+	c.do(ok, "POST", "/users/mfa/totp/confirm", `{"code":"`+totp(t, secret, now)+`"}`, mfa)
+	codes, _ := c.do(ok, "POST", "/users/mfa/recovery-codes", `{"code":"`+totp(t, secret, now.Add(30*time.Second))+`"}`, mfa)["recovery_codes"].([]interface{})
+	if len(codes) < 2 {
+		t.Fatalf("got %d recovery codes", len(codes))
+	}
+	challenge := c.logIn(ok, "grace@example.com", "correct horse")
+	login = c.do(ok, "POST", "/users/login/mfa", `{"mfa_token":"`+str(challenge, "mfa_token")+`","recovery_code":"`+codes[0].(string)+`"}`, "")
+	c.do(ok, "POST", "/users/mfa/totp/disable", `{"recovery_code":"`+codes[1].(string)+`"}`, str(login, "token"))
+	c.do(ok, "DELETE", "/users/"+mfaId+"/mfa", "", admin)
+
+	// Account changes revoke the sessions of the user, so they are made on
+	// a third user.
+	staffId := c.signUp("alan@example.com", "3")
+	staff := str(c.logIn(ok, "alan@example.com", "correct horse"), "token")
+	c.do(ok, "PATCH", "/users/"+staffId, `{"first_name":"Alan"}`, staff)
+	c.do(ok, "POST", "/users/"+staffId+"/password", `{"old_password":"correct horse","new_password":"battery staple"}`, staff)
+	c.do(accepted, "POST", "/users/password/forgot", `{"email":"alan@example.com"}`, "")
+	c.do(ok, "POST", "/users/password/reset", `{"token":"`+c.code("Reset your password")+`","password":"tr0ub4dor and 3"}`, "")
+	c.do(http.StatusUnauthorized, "POST", "/users/login", `{"email":"alan@example.com","password":"battery staple"}`, "")
+	for _, action := range []string{"deactivate", "reactivate", "unlock", "revoke-sessions"} {
+		c.do(ok, "POST", "/users/"+staffId+"/"+action, "", admin)
+	}
+	c.do(ok, "PUT", "/users/"+staffId+"/role", `{"role":"MANAGER"}`, admin)
+	c.do(http.StatusUnprocessableEntity, "PUT", "/users/"+staffId+"/role", `{"role":"OWNER"}`, admin)
+
+	tableId := str(c.do(created, "POST", "/tables", `{"number_of_guests":2,"table_number":1}`, admin), "table_id")
+	c.do(ok, "GET", "/tables", "", admin)
+	c.do(ok, "GET", "/tables/"+tableId, "", admin)
+	c.do(ok, "PATCH", "/tables/"+tableId, `{"number_of_guests":3}`, admin)
+	c.do(ok, "PUT", "/tables/"+tableId, `{"number_of_guests":4}`, admin)
+	c.do(created, "PUT", "/tables/t-9", `{"number_of_guests":2,"table_number":9}`, admin, "If-None-Match", "*")
+	c.do(http.StatusPreconditionFailed, "PUT", "/tables/t-9", `{"number_of_guests":2,"table_number":9}`, admin, "If-None-Match", "*")
+	c.do(http.StatusNotFound, "GET", "/tables/missing", "", admin)
+
+	menuId := str(c.do(created, "POST", "/menus", `{"name":"Lunch","category":"main"}`, admin), "menu_id")
+	c.do(ok, "GET", "/menus", "", admin)
+	c.do(ok, "GET", "/menus/"+menuId, "", admin)
+	c.do(ok, "PUT", "/menus/"+menuId, `{"name":"Dinner"}`, admin)
+	c.do(ok, "PATCH", "/menus/"+menuId, `{"category":"starters"}`, admin)
+
+	foodId := str(c.do(created, "POST", "/foods", `{"name":"Soup","price":3,"food_image":"soup.png","menu_id":"`+menuId+`"}`, admin), "food_id")
+	c.do(ok, "GET", "/foods", "", admin)
+	c.do(ok, "GET", "/foods/"+foodId, "", admin)
+	c.do(ok, "PATCH", "/foods/"+foodId, `{"price":4}`, admin)
+	c.do(http.StatusUnprocessableEntity, "POST", "/foods", `{"name":"Soup","price":-1}`, admin)
+
+	orderId := str(c.do(created, "POST", "/orders", `{"table_id":"`+tableId+`"}`, admin), "order_id")
+	c.do(ok, "GET", "/orders", "", admin)
+	c.do(ok, "GET", "/orders/"+orderId, "", admin)
+	c.do(ok, "PUT", "/orders/"+orderId, `{"table_id":"`+tableId+`"}`, admin)
+	c.do(ok, "PATCH", "/orders/"+orderId, `{"table_id":"`+tableId+`"}`, admin)
+
+	pack := c.do(created, "POST", "/order-items", `{"table_id":"`+tableId+`","order_items":[{"quantity":"M","unit_price":3,"food_id":"`+foodId+`"}]}`, admin)
+	items, _ := pack["order_items"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("got %d order items", len(items))
+	}
+	itemId := str(items[0].(map[string]interface{}), "order_item_id")
+	c.do(ok, "GET", "/order-items", "", admin)
+	c.do(ok, "GET", "/order-items/"+itemId, "", admin)
+	c.do(ok, "GET", "/order-items-order/"+str(items[0].(map[string]interface{}), "order_id"), "", admin)
+	c.do(ok, "PUT", "/order-items/"+itemId, `{"quantity":"L"}`, admin)
+	c.do(ok, "PATCH", "/order-items/"+itemId, `{"unit_price":5}`, admin)
+
+	invoiceId := str(c.do(created, "POST", "/invoices", `{"order_id":"`+orderId+`","payment_status":"PENDING"}`, admin), "invoice_id")
+	c.do(ok, "GET", "/invoices", "", admin)
+	c.do(ok, "GET", "/invoices/"+invoiceId, "", admin)
+	c.do(ok, "PUT", "/invoices/"+invoiceId, `{"payment_method":"CARD"}`, admin)
+	c.do(ok, "PATCH", "/invoices/"+invoiceId, `{"payment_status":"PAID"}`, admin)
+
+	keyId := str(c.do(created, "POST", "/api-keys", `{"name":"kitchen display","role":"KITCHEN"}`, admin), "api_key_id")
+	c.do(ok, "GET", "/api-keys", "", admin)
+	c.do(ok, "GET", "/api-keys/"+keyId, "", admin)
+	c.do(ok, "DELETE", "/api-keys/"+keyId, "", admin)
+
+	for _, path := range []string{"/invoices/" + invoiceId, "/order-items/" + itemId, "/orders/" + orderId, "/foods/" + foodId,
+		"/menus/" + menuId, "/tables/t-9", "/users/" + staffId} {
+		c.do(ok, "DELETE", path, "", admin)
+	}
+	c.do(http.StatusNotFound, "DELETE", "/menus/"+menuId, "", admin)
+	c.do(ok, "POST", "/users/logout", `{"refresh_token":"`+str(pair, "refresh_token")+`"}`, admin)
+
+	for _, route := range routes(t, c.router) {
+		if !c.exercised[route] {
+			t.Errorf("%s was not exercised", route)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/datmedevil17/restaurant-management/apperror"
+	controller "github.com/datmedevil17/restaurant-management/controllers"
+	"github.com/datmedevil17/restaurant-management/helpers"
+	model "github.com/datmedevil17/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Problem is the body of every error response.
+type Problem = apperror.Problem
+
+// Message is the body of responses that only confirm an action.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Status is the body of GET /healthz.
+type Status struct {
+	Status string `json:"status"`
+}
+
+// TokenPair is the body of POST /users/refresh.
+type TokenPair struct {
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+}
+
+// New returns the document describing the routes the app serves.
+func New() *Document {
+	b := &builder{
+		doc: &Document{
+			OpenAPI: "3.1.0",
+			Info: Info{
+				Title:   "Restaurant management API",
+				Version: "1.0.0",
+				Description: "Errors are RFC 7807 problem details. Listings return one page in an " +
+					"{items, next_cursor, total} envelope; pass next_cursor back as ?cursor= for the next page.",
+			},
+			Paths: map[string]map[string]*Operation{},
+			Components: Components{
+				SecuritySchemes: map[string]*SecurityScheme{
+					"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+						Description: "An access token from POST /users/login."},
+					"apiKey": {Type: "apiKey", Name: "X-API-Key", In: "header",
+						Description: "A key issued with POST /api-keys, for machine clients."},
+				},
+			},
+		},
+		gen: &generator{schemas: map[string]*Schema{}},
+	}
+
+	b.system()
+	b.users()
+	b.foods()
+	b.menus()
+	b.orders()
+	b.orderItems()
+	b.tables()
+	b.invoices()
+	b.apiKeys()
+
+	b.doc.Components.Schemas = b.gen.schemas
+	return b.doc
+}
+
+func (b *builder) listOf(item interface{}) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"items":       {Type: "array", Items: b.schema(item)},
+			"next_cursor": {Type: []string{"string", "null"}, Description: "Cursor of the next page, null on the last page."},
+			"total":       {Type: "integer", Description: "Number of matching documents, sent with ?total=true."},
+		},
+		Required: []string{"items", "next_cursor"},
+	}
+}
+
+func (b *builder) anyOf(values ...interface{}) *Schema {
+	s := &Schema{}
+	for _, v := range values {
+		s.AnyOf = append(s.AnyOf, b.schema(v))
+	}
+	return s
+}
+
+func query(name string, description string) *Parameter {
+	return &Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: "string"}}
+}
+
+// listParameters are the parameters every listing takes, followed by its
+// equality filters.
+func listParameters(filters ...*Parameter) []*Parameter {
+	limit, maxLimit := 1.0, 100.0
+	return append([]*Parameter{
+		{Name: "limit", In: "query", Description: "Page size, 20 by default.",
+			Schema: &Schema{Type: "integer", Minimum: &limit, Maximum: &maxLimit}},
+		query("cursor", "The next_cursor of the previous page."),
+		{Name: "sort", In: "query", Description: "Sort order, - for descending.",
+			Schema: &Schema{Type: "string", Enum: []interface{}{"_id", "-_id", "created_at", "-created_at"}}},
+		{Name: "total", In: "query", Description: "Also count the matching documents.",
+			Schema: &Schema{Type: "boolean"}},
+		{Name: "created_after", In: "query", Schema: &Schema{Type: "string", Format: "date-time"}},
+		{Name: "created_before", In: "query", Schema: &Schema{Type: "string", Format: "date-time"}},
+	}, filters...)
+}
+
+func (b *builder) system() {
+	b.add(op{method: "GET", path: "/healthz", tag: "system", summary: "Liveness probe", public: true, response: Status{}})
+	b.add(op{method: "GET", path: "/readyz", tag: "system", public: true, response: controller.ReadinessReport{},
+		summary: "Readiness probe; answers 503 with the same body when a dependency fails"})
+	b.add(op{method: "GET", path: "/version", tag: "system", summary: "Build of the running binary", public: true, response: controller.BuildInfo{}})
+	b.add(op{method: "GET", path: "/metrics", tag: "system", summary: "Prometheus metrics; managers only, as they include revenue",
+		response: &Schema{Type: "string"}, content: "text/plain"})
+	b.add(op{method: "GET", path: "/openapi.json", tag: "system", summary: "This document", public: true,
+		response: &Schema{Type: "object"}})
+	b.add(op{method: "GET", path: "/docs", tag: "system", summary: "Swagger UI for this document", public: true,
+		response: &Schema{Type: "string"}, content: "text/html"})
+	b.add(op{method: "GET", path: "/.well-known/jwks.json", tag: "system", summary: "Public keys that verify tokens", public: true,
+		response: helpers.JWKS{}})
+}
+
+func (b *builder) users() {
+	b.add(op{method: "POST", path: "/users/signup", tag: "users", summary: "Create an account", public: true,
+		body: model.User{}, status: http.StatusCreated, response: controller.UserAdminView{}})
+	b.add(op{method: "POST", path: "/users/login", tag: "users", public: true, body: controller.Credentials{},
+		summary:  "Log in; users who need a second factor get an MFA challenge instead of tokens",
+		response: b.anyOf(controller.LoginResponse{}, controller.MFAChallenge{})})
+	b.add(op{method: "POST", path: "/users/login/mfa", tag: "users", summary: "Finish a login with a second factor", public: true,
+		body: controller.MFALogin{}, response: controller.LoginResponse{}})
+	b.add(op{method: "POST", path: "/users/refresh", tag: "users", summary: "Swap a refresh token for a new token pair", public: true,
+		body: controller.RefreshRequest{}, response: TokenPair{}})
+	b.add(op{method: "POST", path: "/users/password/forgot", tag: "users", summary: "Send a password reset code", public: true,
+		body: controller.PasswordForgot{}, status: http.StatusAccepted, response: Message{}})
+	b.add(op{method: "POST", path: "/users/password/reset", tag: "users", summary: "Reset a password with a reset code", public: true,
+		body: controller.PasswordReset{}, response: Message{}})
+	b.add(op{method: "POST", path: "/users/email/verify", tag: "users", summary: "Verify an email address", public: true,
+		body: controller.EmailVerification{}, response: Message{}})
+
+	b.add(op{method: "POST", path: "/users/mfa/totp/setup", tag: "mfa", summary: "Start TOTP enrolment; also takes an mfa_pending token",
+		response: controller.TOTPEnrolment{}})
+	b.add(op{method: "POST", path: "/users/mfa/totp/confirm", tag: "mfa", summary: "Finish TOTP enrolment; also takes an mfa_pending token",
+		body: controller.TOTPConfirmation{}, response: controller.RecoveryCodes{}})
+	b.add(op{method: "POST", path: "/users/mfa/totp/disable", tag: "mfa", summary: "Turn off two-factor authentication",
+		body: controller.SecondFactor{}, response: Message{}})
+	b.add(op{method: "POST", path: "/users/mfa/recovery-codes", tag: "mfa", summary: "Replace the recovery codes",
+		body: controller.SecondFactor{}, response: controller.RecoveryCodes{}})
+
+	b.add(op{method: "POST", path: "/users/logout", tag: "users", summary: "Revoke the current token pair",
+		body: controller.RefreshRequest{}, response: Message{}})
+	b.add(op{method: "POST", path: "/users/email/resend", tag: "users", summary: "Send a new email verification code",
+		status: http.StatusAccepted, response: Message{}})
+	b.add(op{method: "GET", path: "/users", tag: "users", summary: "List users",
+		query: listParameters(query("role", "Only users with this role.")), response: b.listOf(controller.UserAdminView{})})
+	b.add(op{method: "GET", path: "/users/{user_id}", tag: "users", summary: "Get a user; contact details only for themselves and management",
+		response: b.anyOf(controller.UserAdminView{}, controller.UserPublicView{})})
+	b.add(op{method: "PATCH", path: "/users/{user_id}", tag: "users", summary: "Update a profile", body: controller.UserUpdate{}, response: controller.UserAdminView{}})
+	b.add(op{method: "DELETE", path: "/users/{user_id}", tag: "users", summary: "Delete a user", response: Message{}})
+	b.add(op{method: "POST", path: "/users/{user_id}/password", tag: "users", summary: "Change a password",
+		body: controller.PasswordChange{}, response: Message{}})
+	b.add(op{method: "POST", path: "/users/{user_id}/deactivate", tag: "users", summary: "Deactivate a user", response: Message{}})
+	b.add(op{method: "POST", path: "/users/{user_id}/reactivate", tag: "users", summary: "Reactivate a user", response: controller.UserAdminView{}})
+	b.add(op{method: "PUT", path: "/users/{user_id}/role", tag: "users", summary: "Change the role of a user",
+		body: controller.RoleChange{}, response: controller.UserAdminView{}})
+	b.add(op{method: "POST", path: "/users/{user_id}/unlock", tag: "users", summary: "Clear failed login attempts", response: Message{}})
+	b.add(op{method: "POST", path: "/users/{user_id}/revoke-sessions", tag: "users", summary: "Log a user out everywhere", response: Message{}})
+	b.add(op{method: "DELETE", path: "/users/{user_id}/mfa", tag: "mfa", summary: "Reset the two-factor authentication of a user", response: Message{}})
+}
+
+func (b *builder) foods() {
+	b.add(op{method: "GET", path: "/foods", tag: "foods", summary: "List foods",
+		query: listParameters(query("menu_id", "Only foods of this menu.")), response: b.listOf(model.Food{})})
+	b.add(op{method: "GET", path: "/foods/{food_id}", tag: "foods", summary: "Get a food", response: model.Food{}})
+	b.add(op{method: "POST", path: "/foods", tag: "foods", summary: "Create a food", body: model.Food{}, status: http.StatusCreated, response: model.Food{}})
+	b.add(op{method: "PATCH", path: "/foods/{food_id}", tag: "foods", summary: "Update a food", body: controller.FoodUpdate{}, response: model.Food{}})
+	b.add(op{method: "DELETE", path: "/foods/{food_id}", tag: "foods", summary: "Delete a food", response: Message{}})
+}
+
+func (b *builder) menus() {
+	b.add(op{method: "GET", path: "/menus", tag: "menus", summary: "List menus",
+		query: listParameters(query("category", "Only menus of this category.")), response: b.listOf(model.Menu{})})
+	b.add(op{method: "GET", path: "/menus/{menu_id}", tag: "menus", summary: "Get a menu", response: model.Menu{}})
+	b.add(op{method: "POST", path: "/menus", tag: "menus", summary: "Create a menu", body: model.Menu{}, status: http.StatusCreated, response: model.Menu{}})
+	for _, method := range []string{"PUT", "PATCH"} {
+		b.add(op{method: method, path: "/menus/{menu_id}", tag: "menus", summary: "Update a menu", body: controller.MenuUpdate{}, response: model.Menu{}})
+	}
+	b.add(op{method: "DELETE", path: "/menus/{menu_id}", tag: "menus", summary: "Delete a menu", response: Message{}})
+}
+
+func (b *builder) orders() {
+	b.add(op{method: "GET", path: "/orders", tag: "orders", summary: "List orders",
+		query: listParameters(query("table_id", "Only orders of this table.")), response: b.listOf(model.Order{})})
+	b.add(op{method: "GET", path: "/orders/{order_id}", tag: "orders", summary: "Get an order", response: model.Order{}})
+	b.add(op{method: "POST", path: "/orders", tag: "orders", summary: "Create an order", body: model.Order{}, status: http.StatusCreated, response: model.Order{}})
+	for _, method := range []string{"PUT", "PATCH"} {
+		b.add(op{method: method, path: "/orders/{order_id}", tag: "orders", summary: "Update an order", body: controller.OrderUpdate{}, response: model.Order{}})
+	}
+	b.add(op{method: "DELETE", path: "/orders/{order_id}", tag: "orders", summary: "Delete an order", response: Message{}})
+}
+
+func (b *builder) orderItems() {
+	b.add(op{method: "GET", path: "/order-items", tag: "order items", summary: "List order items",
+		query:    listParameters(query("order_id", "Only items of this order."), query("food_id", "Only items of this food.")),
+		response: b.listOf(model.OrderItem{})})
+	b.add(op{method: "GET", path: "/order-items/{order_item_id}", tag: "order items", summary: "Get an order item", response: model.OrderItem{}})
+	b.add(op{method: "GET", path: "/order-items-order/{order_id}", tag: "order items",
+		summary:  "Get the items of an order, joined with their food and table",
+		response: []bson.M{}})
+	b.add(op{method: "POST", path: "/order-items", tag: "order items", summary: "Create an order for a table with its items",
+		body: controller.OrderItemPack{}, status: http.StatusCreated, response: controller.OrderItemsCreated{}})
+	for _, method := range []string{"PUT", "PATCH"} {
+		b.add(op{method: method, path: "/order-items/{order_item_id}", tag: "order items", summary: "Update an order item",
+			body: controller.OrderItemUpdate{}, response: model.OrderItem{}})
+	}
+	b.add(op{method: "DELETE", path: "/order-items/{order_item_id}", tag: "order items", summary: "Delete an order item", response: Message{}})
+}
+
+func (b *builder) tables() {
+	b.add(op{method: "GET", path: "/tables", tag: "tables", summary: "List tables", query: listParameters(), response: b.listOf(model.Table{})})
+	b.add(op{method: "GET", path: "/tables/{table_id}", tag: "tables", summary: "Get a table", response: model.Table{}})
+	b.add(op{method: "POST", path: "/tables", tag: "tables", summary: "Create a table", body: model.Table{}, status: http.StatusCreated, response: model.Table{}})
+	b.add(op{method: "PATCH", path: "/tables/{table_id}", tag: "tables", summary: "Update a table", body: controller.TableUpdate{}, response: model.Table{}})
+	b.add(op{method: "PUT", path: "/tables/{table_id}", tag: "tables", summary: "Update a table, or create it with If-None-Match: *",
+		query: []*Parameter{{Name: "If-None-Match", In: "header",
+			Description: "* creates the table under table_id from a whole table in the body, failing with 412 if it exists. Without it a missing table is a 404.",
+			Schema:      &Schema{Type: "string", Enum: []interface{}{"*"}}}},
+		body: b.anyOf(controller.TableUpdate{}, model.Table{}), response: model.Table{}})
+	b.doc.Operation("PUT", "/tables/{table_id}").Responses[strconv.Itoa(http.StatusCreated)] = b.response(http.StatusCreated, "", model.Table{})
+	b.add(op{method: "DELETE", path: "/tables/{table_id}", tag: "tables", summary: "Delete a table", response: Message{}})
+}
+
+func (b *builder) invoices() {
+	b.add(op{method: "GET", path: "/invoices", tag: "invoices", summary: "List invoices",
+		query: listParameters(
+			query("order_id", "Only invoices of this order."),
+			&Parameter{Name: "status", In: "query", Description: "Only invoices with this payment status.",
+				Schema: &Schema{Type: "string", Enum: []interface{}{"PENDING", "PAID"}}},
+			&Parameter{Name: "payment_method", In: "query", Description: "Only invoices paid this way.",
+				Schema: &Schema{Type: "string", Enum: []interface{}{"CARD", "CASH"}}},
+		),
+		response: b.listOf(model.Invoice{})})
+	b.add(op{method: "GET", path: "/invoices/{invoice_id}", tag: "invoices", summary: "Get an invoice with the amount due", response: controller.InvoiceViewFormat{}})
+	b.add(op{method: "POST", path: "/invoices", tag: "invoices", summary: "Create an invoice", body: model.Invoice{}, status: http.StatusCreated, response: model.Invoice{}})
+	for _, method := range []string{"PUT", "PATCH"} {
+		b.add(op{method: method, path: "/invoices/{invoice_id}", tag: "invoices", summary: "Update an invoice", body: controller.InvoiceUpdate{}, response: model.Invoice{}})
+	}
+	b.add(op{method: "DELETE", path: "/invoices/{invoice_id}", tag: "invoices", summary: "Delete an invoice", response: Message{}})
+}
+
+func (b *builder) apiKeys() {
+	b.add(op{method: "GET", path: "/api-keys", tag: "api keys", summary: "List API keys",
+		query: listParameters(&Parameter{Name: "role", In: "query", Description: "Only keys acting as this role.",
+			Schema: &Schema{Type: "string", Enum: []interface{}{"MANAGER", "WAITER", "KITCHEN", "CASHIER"}}}),
+		response: b.listOf(model.APIKey{})})
+	b.add(op{method: "GET", path: "/api-keys/{api_key_id}", tag: "api keys", summary: "Get an API key", response: model.APIKey{}})
+	b.add(op{method: "POST", path: "/api-keys", tag: "api keys", summary: "Issue an API key; the key itself is only shown here",
+		body: model.APIKey{}, status: http.StatusCreated, response: controller.APIKeyCreated{}})
+	b.add(op{method: "DELETE", path: "/api-keys/{api_key_id}", tag: "api keys", summary: "Revoke an API key", response: Message{}})
+}
@@ -0,0 +1,157 @@
+package openapi_test
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/datmedevil17/restaurant-management/openapi"
+)
+
+// validate returns every way v, a decoded JSON value, breaks schema s of doc.
+// It knows the keywords the generator emits, and unlike JSON Schema it
+// refuses object members that are not described, so a field added to a
+// response without the document following is caught.
+func validate(doc *openapi.Document, s *openapi.Schema, v interface{}, path string) []string {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		target := doc.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if target == nil {
+			return []string{fmt.Sprintf("%s: unknown schema %s", path, s.Ref)}
+		}
+		return validate(doc, target, v, path)
+	}
+	if len(s.AnyOf) > 0 {
+		var problems []string
+		for _, branch := range s.AnyOf {
+			branchProblems := validate(doc, branch, v, path)
+			if len(branchProblems) == 0 {
+				return nil
+			}
+			problems = append(problems, branchProblems...)
+		}
+		return append([]string{fmt.Sprintf("%s: matches none of anyOf", path)}, problems...)
+	}
+
+	if types := schemaTypes(s.Type); len(types) > 0 && !slices.ContainsFunc(types, func(name string) bool { return hasType(v, name) }) {
+		return []string{fmt.Sprintf("%s: %s is not %s", path, jsonType(v), strings.Join(types, " or "))}
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(value interface{}) bool { return reflect.DeepEqual(value, v) }) {
+		return []string{fmt.Sprintf("%s: %v is not one of %v", path, v, s.Enum)}
+	}
+
+	var problems []string
+	switch v := v.(type) {
+	case string:
+		if s.Pattern != "" {
+			if ok, err := regexp.MatchString(s.Pattern, v); err != nil || !ok {
+				problems = append(problems, fmt.Sprintf("%s: %q does not match %s", path, v, s.Pattern))
+			}
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, v); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", path, v))
+			}
+		}
+		if s.MinLength != nil && utf8.RuneCountInString(v) < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s: shorter than %d", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && utf8.RuneCountInString(v) > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s: longer than %d", path, *s.MaxLength))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is below %v", path, v, *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s: %v is above %v", path, v, *s.Maximum))
+		}
+		if s.ExclusiveMinimum != nil && v <= *s.ExclusiveMinimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is not above %v", path, v, *s.ExclusiveMinimum))
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			problems = append(problems, fmt.Sprintf("%s: fewer than %d items", path, *s.MinItems))
+		}
+		for i, item := range v {
+			problems = append(problems, validate(doc, s.Items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: %s is required", path, name))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			switch member := s.Properties[name]; {
+			case member != nil:
+				problems = append(problems, validate(doc, member, v[name], path+"."+name)...)
+			case s.AdditionalProperties != nil:
+				problems = append(problems, validate(doc, s.AdditionalProperties, v[name], path+"."+name)...)
+			case s.Properties != nil:
+				problems = append(problems, fmt.Sprintf("%s: %s is not documented", path, name))
+			}
+		}
+	}
+	return problems
+}
+
+// schemaTypes reads the type keyword, which is a name or a list of names.
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasType(v interface{}, name string) bool {
+	if name == "integer" {
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	}
+	return jsonType(v) == name || name == "number" && jsonType(v) == "integer"
+}
+
+// jsonType names the JSON type of v as encoding/json decodes it.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidCursor is returned when a ListQuery cursor was not issued for the
+// same sort order, or was not issued by us at all.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// DefaultListLimit is the page size of a ListQuery without a Limit.
+const DefaultListLimit = 20
+
+// Sort orders a listing supports. Documents with the same created_at are
+// ordered by _id, so every order is total and pages never overlap.
+const (
+	SortID        = "_id"
+	SortCreatedAt = "created_at"
+)
+
+// ListQuery selects one page of a listing. Filters holds equality matches
+// keyed by bson field name; Cursor is the Next_cursor of the previous page.
+type ListQuery struct {
+	Limit          int
+	Sort           string
+	Descending     bool
+	Cursor         string
+	Filters        map[string]interface{}
+	Created_after  *time.Time
+	Created_before *time.Time
+	// WithTotal asks for the number of documents matching the filters,
+	// which costs a count on every page.
+	WithTotal bool
+}
+
+// Page is one page of a listing. Next_cursor is empty on the last page and
+// Total is only set when the query asked for it.
+type Page[T any] struct {
+	Items       []T
+	Next_cursor string
+	Total       *int64
+}
+
+// cursor is the position after the last document of a page. It is handed to
+// clients base64 encoded and must be treated as opaque by them.
+type cursor struct {
+	Sort       string             `json:"s"`
+	Descending bool               `json:"d,omitempty"`
+	ID         primitive.ObjectID `json:"i"`
+	Created_at time.Time          `json:"c,omitempty"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses the cursor of q, which must have been issued for the
+// same sort order. It returns nil when q starts at the first page.
+func decodeCursor(q ListQuery) (*cursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sortOf(q) || c.Descending != q.Descending || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func sortOf(q ListQuery) string {
+	if q.Sort == "" {
+		return SortID
+	}
+	return q.Sort
+}
+
+func limitOf(q ListQuery) int {
+	if q.Limit < 1 {
+		return DefaultListLimit
+	}
+	return q.Limit
+}
+
+// compare orders two documents, given by _id and created_at, the way q sorts
+// them.
+func compare(q ListQuery, id1 primitive.ObjectID, createdAt1 time.Time, id2 primitive.ObjectID, createdAt2 time.Time) int {
+	cmp := 0
+	if sortOf(q) == SortCreatedAt {
+		cmp = createdAt1.Compare(createdAt2)
+	}
+	if cmp == 0 {
+		cmp = bytes.Compare(id1[:], id2[:])
+	}
+	if q.Descending {
+		return -cmp
+	}
+	return cmp
+}
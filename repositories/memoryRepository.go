@@ -0,0 +1,605 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	model "github.com/datmedevil17/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryCollection implements Crud in process memory. Documents are kept as
+// marshalled BSON so callers never share pointers with the store, and $set
+// updates go through the same bson tags the Mongo implementation uses.
+type memoryCollection[T any] struct {
+	mu     sync.RWMutex
+	key    string
+	upsert bool
+	ids    []string
+	docs   map[string]bson.D
+}
+
+func newMemoryCollection[T any](key string, upsert bool) *memoryCollection[T] {
+	return &memoryCollection[T]{key: key, upsert: upsert, docs: map[string]bson.D{}}
+}
+
+func lookup(doc bson.D, key string) (interface{}, bool) {
+	for _, e := range doc {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func set(doc bson.D, key string, value interface{}) bson.D {
+	for i, e := range doc {
+		if e.Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+// toDoc round-trips v through BSON so the result holds only plain values.
+func toDoc(v interface{}) (bson.D, error) {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func fromDoc[T any](doc bson.D) (T, error) {
+	var v T
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return v, err
+	}
+	err = bson.Unmarshal(data, &v)
+	return v, err
+}
+
+func (c *memoryCollection[T]) keyOf(doc bson.D) (string, error) {
+	value, ok := lookup(doc, c.key)
+	if !ok {
+		return "", fmt.Errorf("document has no %q field", c.key)
+	}
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return v.Hex(), nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("unsupported %q value of type %T", c.key, value)
+}
+
+func (c *memoryCollection[T]) filter(pred func(*T) bool) ([]T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var docs []T
+	for _, id := range c.ids {
+		doc, err := fromDoc[T](c.docs[id])
+		if err != nil {
+			return nil, err
+		}
+		if pred == nil || pred(&doc) {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func (c *memoryCollection[T]) List(ctx context.Context) ([]T, error) {
+	return c.filter(nil)
+}
+
+// position returns the fields a listing sorts doc on.
+func position(doc bson.D) (primitive.ObjectID, time.Time) {
+	value, _ := lookup(doc, "_id")
+	id, _ := value.(primitive.ObjectID)
+	value, _ = lookup(doc, "created_at")
+	createdAt, _ := value.(primitive.DateTime)
+	return id, createdAt.Time()
+}
+
+// matches reports whether doc passes the filters of q. Filter values are
+// round-tripped through BSON so they compare like the stored values do.
+func matches(doc bson.D, q ListQuery, filters bson.D) bool {
+	for _, e := range filters {
+		if value, _ := lookup(doc, e.Key); value != e.Value {
+			return false
+		}
+	}
+	_, createdAt := position(doc)
+	if q.Created_after != nil && !createdAt.After(*q.Created_after) {
+		return false
+	}
+	if q.Created_before != nil && !createdAt.Before(*q.Created_before) {
+		return false
+	}
+	return true
+}
+
+func (c *memoryCollection[T]) ListPage(ctx context.Context, q ListQuery) (*Page[T], error) {
+	after, err := decodeCursor(q)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := toDoc(bson.M(q.Filters))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var docs []bson.D
+	for _, id := range c.ids {
+		if doc := c.docs[id]; matches(doc, q, filters) {
+			docs = append(docs, doc)
+		}
+	}
+
+	page := &Page[T]{Items: []T{}}
+	if q.WithTotal {
+		total := int64(len(docs))
+		page.Total = &total
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		id1, createdAt1 := position(docs[i])
+		id2, createdAt2 := position(docs[j])
+		return compare(q, id1, createdAt1, id2, createdAt2) < 0
+	})
+
+	limit := limitOf(q)
+	var last bson.D
+	for _, doc := range docs {
+		id, createdAt := position(doc)
+		if after != nil && compare(q, id, createdAt, after.ID, after.Created_at) <= 0 {
+			continue
+		}
+		if len(page.Items) == limit {
+			id, createdAt := position(last)
+			page.Next_cursor = cursor{Sort: sortOf(q), Descending: q.Descending, ID: id, Created_at: createdAt}.encode()
+			break
+		}
+		v, err := fromDoc[T](doc)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, v)
+		last = doc
+	}
+	return page, nil
+}
+
+func (c *memoryCollection[T]) Get(ctx context.Context, id string) (*T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	doc, ok := c.docs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	v, err := fromDoc[T](doc)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (c *memoryCollection[T]) insert(doc T) (interface{}, error) {
+	d, err := toDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := lookup(d, "_id"); !ok {
+		d = append(bson.D{{Key: "_id", Value: primitive.NewObjectID()}}, d...)
+	}
+	id, err := c.keyOf(d)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.docs[id]; ok {
+		return nil, fmt.Errorf("%w %s: %s", ErrDuplicateKey, c.key, id)
+	}
+	c.docs[id] = d
+	c.ids = append(c.ids, id)
+	insertedID, _ := lookup(d, "_id")
+	return insertedID, nil
+}
+
+func (c *memoryCollection[T]) Create(ctx context.Context, doc T) (*mongo.InsertOneResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	insertedID, err := c.insert(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: insertedID}, nil
+}
+
+func (c *memoryCollection[T]) Update(ctx context.Context, id string, fields bson.D) (*mongo.UpdateResult, error) {
+	update, err := toDoc(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := &mongo.UpdateResult{}
+	doc, ok := c.docs[id]
+	if ok {
+		result.MatchedCount = 1
+	} else {
+		if !c.upsert {
+			return result, ErrNotFound
+		}
+		var key interface{} = id
+		if c.key == "_id" {
+			if key, err = primitive.ObjectIDFromHex(id); err != nil {
+				return nil, err
+			}
+		}
+		doc = bson.D{{Key: "_id", Value: primitive.NewObjectID()}}
+		doc = set(doc, c.key, key)
+		result.UpsertedCount = 1
+		result.UpsertedID, _ = lookup(doc, "_id")
+	}
+
+	for _, e := range update {
+		doc = set(doc, e.Key, e.Value)
+	}
+	if _, err := fromDoc[T](doc); err != nil {
+		return nil, err
+	}
+	if ok {
+		result.ModifiedCount = 1
+	} else {
+		c.ids = append(c.ids, id)
+	}
+	c.docs[id] = doc
+	return result, nil
+}
+
+func (c *memoryCollection[T]) UpdateAndGet(ctx context.Context, id string, fields bson.D) (*T, error) {
+	return c.updateAndGetIf(id, fields, nil)
+}
+
+// updateAndGetIf is UpdateAndGet that only updates a document for which
+// match, if given, is true, treating others as missing.
+func (c *memoryCollection[T]) updateAndGetIf(id string, fields bson.D, match func(doc bson.D) bool) (*T, error) {
+	update, err := toDoc(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	doc, ok := c.docs[id]
+	if !ok || match != nil && !match(doc) {
+		return nil, ErrNotFound
+	}
+	updated := append(bson.D{}, doc...)
+	for _, e := range update {
+		updated = set(updated, e.Key, e.Value)
+	}
+	v, err := fromDoc[T](updated)
+	if err != nil {
+		return nil, err
+	}
+	c.docs[id] = updated
+	return &v, nil
+}
+
+func (c *memoryCollection[T]) Delete(ctx context.Context, id string) (*mongo.DeleteResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; !ok {
+		return &mongo.DeleteResult{}, nil
+	}
+	delete(c.docs, id)
+	for i, existing := range c.ids {
+		if existing == id {
+			c.ids = append(c.ids[:i], c.ids[i+1:]...)
+			break
+		}
+	}
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+type memoryOrderItemRepository struct {
+	*memoryCollection[model.OrderItem]
+	foods  *memoryCollection[model.Food]
+	orders *memoryCollection[model.Order]
+	tables *memoryCollection[model.Table]
+}
+
+func (r *memoryOrderItemRepository) CreateMany(ctx context.Context, items []model.OrderItem) (*mongo.InsertManyResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &mongo.InsertManyResult{}
+	for _, item := range items {
+		insertedID, err := r.insert(item)
+		if err != nil {
+			return result, err
+		}
+		result.InsertedIDs = append(result.InsertedIDs, insertedID)
+	}
+	return result, nil
+}
+
+func (r *memoryOrderItemRepository) ListByOrder(ctx context.Context, orderId string) ([]model.OrderItem, error) {
+	return r.filter(func(item *model.OrderItem) bool {
+		return item.Order_id == orderId
+	})
+}
+
+// ItemsByOrder mirrors the shape of the Mongo aggregation: a single group per
+// order holding the joined food, order and table fields of each item.
+func (r *memoryOrderItemRepository) ItemsByOrder(ctx context.Context, orderId string) ([]bson.M, error) {
+	items, err := r.ListByOrder(ctx, orderId)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+
+	group := bson.M{}
+	var orderItems []bson.M
+	for _, item := range items {
+		view := bson.M{"_id": item.ID, "quantity": item.Quantity}
+
+		if item.Food_id != nil {
+			foods, err := r.foods.filter(func(food *model.Food) bool {
+				return food.Food_id == *item.Food_id
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(foods) > 0 {
+				view["amount"] = foods[0].Price
+				view["price"] = foods[0].Price
+				view["food_name"] = foods[0].Name
+				view["food_image"] = foods[0].Food_image
+			}
+		}
+
+		order, err := r.orders.Get(ctx, item.Order_id)
+		if err != nil && err != ErrNotFound {
+			return nil, err
+		}
+		if order != nil {
+			view["order_id"] = order.Order_id
+			group["order_id"] = order.Order_id
+			if order.Table_id != nil {
+				table, err := r.tables.Get(ctx, *order.Table_id)
+				if err != nil && err != ErrNotFound {
+					return nil, err
+				}
+				if table != nil {
+					view["table_id"] = table.Table_id
+					view["table_number"] = table.Table_number
+					group["table_id"] = table.Table_id
+					group["table_number"] = table.Table_number
+				}
+			}
+		}
+		orderItems = append(orderItems, view)
+	}
+
+	return []bson.M{{
+		"_id":          group,
+		"table_number": group["table_number"],
+		"order_items":  orderItems,
+	}}, nil
+}
+
+type memoryInvoiceRepository struct {
+	*memoryCollection[model.Invoice]
+}
+
+func (r *memoryInvoiceRepository) UpdateUnpaid(ctx context.Context, id string, fields bson.D) (*model.Invoice, error) {
+	return r.updateAndGetIf(id, fields, func(doc bson.D) bool {
+		status, _ := lookup(doc, "payment_status")
+		return status != "PAID"
+	})
+}
+
+type memoryUserRepository struct {
+	*memoryCollection[model.User]
+}
+
+func (r *memoryUserRepository) ListPage(ctx context.Context, q ListQuery) (*Page[model.User], error) {
+	page, err := r.memoryCollection.ListPage(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	// Mirror the projection of the Mongo implementation.
+	for i := range page.Items {
+		page.Items[i].Password = nil
+		page.Items[i].Token = nil
+		page.Items[i].Refresh_Token = nil
+		page.Items[i].Totp_secret = nil
+		page.Items[i].Recovery_codes = nil
+	}
+	return page, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	users, err := r.filter(func(user *model.User) bool {
+		return user.Email != nil && *user.Email == email
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return &users[0], nil
+}
+
+func (r *memoryUserRepository) Count(ctx context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return int64(len(r.ids)), nil
+}
+
+func (r *memoryUserRepository) CountByEmail(ctx context.Context, email string) (int64, error) {
+	users, err := r.filter(func(user *model.User) bool {
+		return user.Email != nil && *user.Email == email
+	})
+	return int64(len(users)), err
+}
+
+func (r *memoryUserRepository) CountByPhone(ctx context.Context, phone string) (int64, error) {
+	users, err := r.filter(func(user *model.User) bool {
+		return user.Phone != nil && *user.Phone == phone
+	})
+	return int64(len(users)), err
+}
+
+func (r *memoryUserRepository) UseTOTPStep(ctx context.Context, userId string, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.docs[userId]
+	if !ok {
+		return false, nil
+	}
+	stored, _ := lookup(doc, "totp_last_step")
+	if last, ok := stored.(int64); ok && last >= step {
+		return false, nil
+	}
+	r.docs[userId] = set(doc, "totp_last_step", step)
+	return true, nil
+}
+
+func (r *memoryUserRepository) UseRecoveryCode(ctx context.Context, userId string, hash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.docs[userId]
+	if !ok {
+		return false, nil
+	}
+	stored, _ := lookup(doc, "recovery_codes")
+	codes, _ := stored.(bson.A)
+	i := slices.Index(codes, interface{}(hash))
+	if i < 0 {
+		return false, nil
+	}
+	r.docs[userId] = set(doc, "recovery_codes", slices.Delete(slices.Clone(codes), i, i+1))
+	return true, nil
+}
+
+type memorySessionRepository struct {
+	*memoryCollection[model.Session]
+}
+
+func (r *memorySessionRepository) Rotate(ctx context.Context, sessionId string, current string, next string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.docs[sessionId]
+	if !ok {
+		return false, nil
+	}
+	if stored, _ := lookup(doc, "refresh_id"); stored != current {
+		return false, nil
+	}
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	doc = set(doc, "refresh_id", next)
+	doc = set(doc, "expires_at", primitive.NewDateTimeFromTime(expiresAt))
+	doc = set(doc, "updated_at", primitive.NewDateTimeFromTime(updated_at))
+	r.docs[sessionId] = doc
+	return true, nil
+}
+
+type memoryUserTokenRepository struct {
+	*memoryCollection[model.UserToken]
+}
+
+func (r *memoryUserTokenRepository) Consume(ctx context.Context, tokenHash string, purpose string) (*model.UserToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	doc, ok := r.docs[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	token, err := fromDoc[model.UserToken](doc)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token.Purpose != purpose || token.Used_at != nil || !now.Before(token.Expires_at) {
+		return nil, ErrNotFound
+	}
+
+	r.docs[tokenHash] = set(doc, "used_at", primitive.NewDateTimeFromTime(now))
+	token.Used_at = &now
+	return &token, nil
+}
+
+type memoryAPIKeyRepository struct {
+	*memoryCollection[model.APIKey]
+}
+
+func (r *memoryAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	keys, err := r.filter(func(key *model.APIKey) bool {
+		return key.Key_hash == keyHash
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrNotFound
+	}
+	return &keys[0], nil
+}
+
+// NewMemory returns empty repositories held in process memory, for tests and
+// running the API without a MongoDB server.
+func NewMemory() *Repositories {
+	foods := newMemoryCollection[model.Food]("_id", false)
+	orders := newMemoryCollection[model.Order]("order_id", false)
+	tables := newMemoryCollection[model.Table]("table_id", false)
+
+	return &Repositories{
+		Foods:  foods,
+		Menus:  newMemoryCollection[model.Menu]("_id", false),
+		Orders: orders,
+		OrderItems: &memoryOrderItemRepository{
+			memoryCollection: newMemoryCollection[model.OrderItem]("order_item_id", false),
+			foods:            foods,
+			orders:           orders,
+			tables:           tables,
+		},
+		Tables:      tables,
+		Invoices:    &memoryInvoiceRepository{newMemoryCollection[model.Invoice]("invoice_id", false)},
+		Users:       &memoryUserRepository{newMemoryCollection[model.User]("user_id", false)},
+		Sessions:    &memorySessionRepository{newMemoryCollection[model.Session]("session_id", false)},
+		Notes:       newMemoryCollection[model.Note]("note_id", false),
+		Revocations: newMemoryCollection[model.RevokedToken]("jti", true),
+		UserTokens:  &memoryUserTokenRepository{newMemoryCollection[model.UserToken]("token_hash", false)},
+		APIKeys:     &memoryAPIKeyRepository{newMemoryCollection[model.APIKey]("api_key_id", false)},
+	}
+}
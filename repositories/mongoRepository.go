@@ -0,0 +1,536 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	model "github.com/datmedevil17/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoCollection implements Crud on top of a single Mongo collection. key is
+// the field ids are matched against; "_id" ids are parsed as ObjectID hex.
+type mongoCollection[T any] struct {
+	collection *mongo.Collection
+	key        string
+	upsert     bool
+}
+
+func newMongoCollection[T any](db *mongo.Database, name string, key string, upsert bool) *mongoCollection[T] {
+	return &mongoCollection[T]{collection: db.Collection(name), key: key, upsert: upsert}
+}
+
+// filter matches the document with id. An id that is not ObjectID hex is
+// ErrNotFound for "_id" keys, as no document can have it.
+func (c *mongoCollection[T]) filter(id string) (bson.M, error) {
+	if c.key != "_id" {
+		return bson.M{c.key: id}, nil
+	}
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return bson.M{"_id": oId}, nil
+}
+
+func (c *mongoCollection[T]) find(ctx context.Context, filter interface{}) ([]T, error) {
+	cursor, err := c.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []T
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, cursor.Err()
+}
+
+func (c *mongoCollection[T]) findOne(ctx context.Context, filter interface{}) (*T, error) {
+	var doc T
+	err := c.collection.FindOne(ctx, filter).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (c *mongoCollection[T]) List(ctx context.Context) ([]T, error) {
+	return c.find(ctx, bson.M{})
+}
+
+func (c *mongoCollection[T]) ListPage(ctx context.Context, q ListQuery) (*Page[T], error) {
+	return c.listPage(ctx, q, nil)
+}
+
+// listFilter matches the documents q lists, whatever page it is on.
+func listFilter(q ListQuery) bson.D {
+	fields := make([]string, 0, len(q.Filters))
+	for field := range q.Filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	filter := bson.D{}
+	for _, field := range fields {
+		filter = append(filter, bson.E{Key: field, Value: q.Filters[field]})
+	}
+
+	var created bson.D
+	if q.Created_after != nil {
+		created = append(created, bson.E{Key: "$gt", Value: *q.Created_after})
+	}
+	if q.Created_before != nil {
+		created = append(created, bson.E{Key: "$lt", Value: *q.Created_before})
+	}
+	if created != nil {
+		filter = append(filter, bson.E{Key: "created_at", Value: created})
+	}
+	return filter
+}
+
+// listPage reads one page of q with a keyset on the sort fields, fetching one
+// document more than the limit to learn whether another page follows.
+func (c *mongoCollection[T]) listPage(ctx context.Context, q ListQuery, projection bson.D) (*Page[T], error) {
+	after, err := decodeCursor(q)
+	if err != nil {
+		return nil, err
+	}
+	filter := listFilter(q)
+	limit := limitOf(q)
+
+	page := &Page[T]{Items: []T{}}
+	if q.WithTotal {
+		total, err := c.collection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	order, op := 1, "$gt"
+	if q.Descending {
+		order, op = -1, "$lt"
+	}
+	sortBy := bson.D{{Key: "_id", Value: order}}
+	if sortOf(q) == SortCreatedAt {
+		sortBy = bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}}
+	}
+	if after != nil {
+		keyset := bson.D{{Key: "_id", Value: bson.D{{Key: op, Value: after.ID}}}}
+		if sortOf(q) == SortCreatedAt {
+			keyset = bson.D{{Key: "$or", Value: bson.A{
+				bson.D{{Key: "created_at", Value: bson.D{{Key: op, Value: after.Created_at}}}},
+				bson.D{{Key: "created_at", Value: after.Created_at}, {Key: "_id", Value: bson.D{{Key: op, Value: after.ID}}}},
+			}}}
+		}
+		filter = bson.D{{Key: "$and", Value: bson.A{filter, keyset}}}
+	}
+
+	opt := options.Find().SetSort(sortBy).SetLimit(int64(limit) + 1)
+	if projection != nil {
+		opt.SetProjection(projection)
+	}
+	cur, err := c.collection.Find(ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var last bson.Raw
+	for cur.Next(ctx) {
+		if len(page.Items) == limit {
+			id, _ := last.Lookup("_id").ObjectIDOK()
+			createdAt, _ := last.Lookup("created_at").TimeOK()
+			page.Next_cursor = cursor{Sort: sortOf(q), Descending: q.Descending, ID: id, Created_at: createdAt}.encode()
+			break
+		}
+		var doc T
+		if err := cur.Decode(&doc); err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, doc)
+		last = append(last[:0], cur.Current...)
+	}
+	return page, cur.Err()
+}
+
+func (c *mongoCollection[T]) Get(ctx context.Context, id string) (*T, error) {
+	filter, err := c.filter(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.findOne(ctx, filter)
+}
+
+func (c *mongoCollection[T]) Create(ctx context.Context, doc T) (*mongo.InsertOneResult, error) {
+	result, err := c.collection.InsertOne(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("%w: %w", ErrDuplicateKey, err)
+	}
+	return result, err
+}
+
+func (c *mongoCollection[T]) Update(ctx context.Context, id string, set bson.D) (*mongo.UpdateResult, error) {
+	filter, err := c.filter(id)
+	if err != nil {
+		return nil, err
+	}
+	opt := options.UpdateOptions{
+		Upsert: &c.upsert,
+	}
+	result, err := c.collection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}}, &opt)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 && result.UpsertedCount == 0 {
+		return result, ErrNotFound
+	}
+	return result, nil
+}
+
+func (c *mongoCollection[T]) UpdateAndGet(ctx context.Context, id string, set bson.D) (*T, error) {
+	filter, err := c.filter(id)
+	if err != nil {
+		return nil, err
+	}
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var doc T
+	err = c.collection.FindOneAndUpdate(ctx, filter, bson.D{{Key: "$set", Value: set}}, opt).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (c *mongoCollection[T]) Delete(ctx context.Context, id string) (*mongo.DeleteResult, error) {
+	filter, err := c.filter(id)
+	if err != nil {
+		// Nothing to delete, as with any other id that matches nothing.
+		return &mongo.DeleteResult{}, nil
+	}
+	return c.collection.DeleteOne(ctx, filter)
+}
+
+type mongoOrderItemRepository struct {
+	*mongoCollection[model.OrderItem]
+}
+
+func (r *mongoOrderItemRepository) CreateMany(ctx context.Context, items []model.OrderItem) (*mongo.InsertManyResult, error) {
+	docs := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		docs = append(docs, item)
+	}
+	return r.collection.InsertMany(ctx, docs)
+}
+
+func (r *mongoOrderItemRepository) ListByOrder(ctx context.Context, orderId string) ([]model.OrderItem, error) {
+	return r.find(ctx, bson.M{"order_id": orderId})
+}
+
+func (r *mongoOrderItemRepository) ItemsByOrder(ctx context.Context, orderId string) (OrderItems []bson.M, err error) {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: orderId}}}}
+	lookupStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "food"}, {Key: "localField", Value: "food_id"}, {Key: "foreignField", Value: "food_id"}, {Key: "as", Value: "food"}}}}
+	unwindStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$food"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
+
+	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "order"}, {Key: "localField", Value: "order_id"}, {Key: "foreignField", Value: "order_id"}, {Key: "as", Value: "order"}}}}
+	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$order"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
+
+	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "table"}, {Key: "localField", Value: "order.table_id"}, {Key: "foreignField", Value: "table_id"}, {Key: "as", Value: "table"}}}}
+	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$table"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}}
+
+	projectStage := bson.D{
+		{Key: "$project", Value: bson.D{
+			{Key: "id", Value: 0},
+			{Key: "amount", Value: "$food.price"},
+			{Key: "total_count", Value: 1},
+			{Key: "food_name", Value: "$food.name"},
+			{Key: "food_image", Value: "$food.food_image"},
+			{Key: "table_number", Value: "$table.table_number"},
+			{Key: "table_id", Value: "$table.table_id"},
+			{Key: "order_id", Value: "$order.order_id"},
+			{Key: "price", Value: "$food.price"},
+			{Key: "quantity", Value: 1},
+		}}}
+
+	groupStage := bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "order_id", Value: "$order_id"}, {Key: "table_id", Value: "$table_id"}, {Key: "table_number", Value: "$table_number"}}}, {Key: "order_items", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}}}}}
+
+	projectStage2 := bson.D{
+		{Key: "$project", Value: bson.D{
+			{Key: "id", Value: 0},
+			{Key: "payment_due", Value: 1},
+			{Key: "total_count", Value: 1},
+			{Key: "table_number", Value: "$_id.table_number"},
+			{Key: "order_items", Value: 1},
+		}}}
+
+	var allStages mongo.Pipeline
+
+	allStages = append(allStages, matchStage)
+	allStages = append(allStages, lookupStage)
+	allStages = append(allStages, unwindStage)
+	allStages = append(allStages, lookupOrderStage)
+	allStages = append(allStages, unwindOrderStage)
+	allStages = append(allStages, lookupTableStage)
+	allStages = append(allStages, unwindTableStage)
+	allStages = append(allStages, projectStage)
+	allStages = append(allStages, groupStage)
+	allStages = append(allStages, projectStage2)
+
+	result, err := r.collection.Aggregate(ctx, allStages)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = result.All(ctx, &OrderItems); err != nil {
+		return nil, err
+	}
+
+	return OrderItems, err
+}
+
+type mongoInvoiceRepository struct {
+	*mongoCollection[model.Invoice]
+}
+
+func (r *mongoInvoiceRepository) UpdateUnpaid(ctx context.Context, id string, set bson.D) (*model.Invoice, error) {
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var invoice model.Invoice
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"invoice_id": id, "payment_status": bson.M{"$ne": "PAID"}},
+		bson.D{{Key: "$set", Value: set}}, opt,
+	).Decode(&invoice)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+type mongoUserRepository struct {
+	*mongoCollection[model.User]
+}
+
+// hiddenUserFields are never read back when listing users.
+var hiddenUserFields = bson.D{
+	{Key: "password", Value: 0},
+	{Key: "token", Value: 0},
+	{Key: "refresh_token", Value: 0},
+	{Key: "totp_secret", Value: 0},
+	{Key: "recovery_codes", Value: 0},
+}
+
+func (r *mongoUserRepository) ListPage(ctx context.Context, q ListQuery) (*Page[model.User], error) {
+	return r.listPage(ctx, q, hiddenUserFields)
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) Count(ctx context.Context) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{})
+}
+
+func (r *mongoUserRepository) CountByEmail(ctx context.Context, email string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) CountByPhone(ctx context.Context, phone string) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{"phone": phone})
+}
+
+func (r *mongoUserRepository) UseTOTPStep(ctx context.Context, userId string, step int64) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"user_id": userId, "totp_last_step": bson.M{"$lt": step}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_step", Value: step}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+func (r *mongoUserRepository) UseRecoveryCode(ctx context.Context, userId string, hash string) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"user_id": userId, "recovery_codes": hash},
+		bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_codes", Value: hash}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+type mongoSessionRepository struct {
+	*mongoCollection[model.Session]
+}
+
+func (r *mongoSessionRepository) Rotate(ctx context.Context, sessionId string, current string, next string, expiresAt time.Time) (bool, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"session_id": sessionId, "refresh_id": current},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "refresh_id", Value: next},
+			{Key: "expires_at", Value: expiresAt},
+			{Key: "updated_at", Value: updated_at},
+		}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+type mongoUserTokenRepository struct {
+	*mongoCollection[model.UserToken]
+}
+
+func (r *mongoUserTokenRepository) Consume(ctx context.Context, tokenHash string, purpose string) (*model.UserToken, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"purpose":    purpose,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+	opt := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var token model.UserToken
+	err := r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}, opt).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+type mongoAPIKeyRepository struct {
+	*mongoCollection[model.APIKey]
+}
+
+func (r *mongoAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	return r.findOne(ctx, bson.M{"key_hash": keyHash})
+}
+
+// NewMongo returns repositories backed by the collections of db.
+func NewMongo(db *mongo.Database) *Repositories {
+	return &Repositories{
+		Foods:       newMongoCollection[model.Food](db, "food", "_id", false),
+		Menus:       newMongoCollection[model.Menu](db, "menu", "_id", false),
+		Orders:      newMongoCollection[model.Order](db, "order", "order_id", false),
+		OrderItems:  &mongoOrderItemRepository{newMongoCollection[model.OrderItem](db, "order_item", "order_item_id", false)},
+		Tables:      newMongoCollection[model.Table](db, "table", "table_id", false),
+		Invoices:    &mongoInvoiceRepository{newMongoCollection[model.Invoice](db, "invoice", "invoice_id", false)},
+		Users:       &mongoUserRepository{newMongoCollection[model.User](db, "user", "user_id", false)},
+		Sessions:    &mongoSessionRepository{newMongoCollection[model.Session](db, "session", "session_id", false)},
+		Notes:       newMongoCollection[model.Note](db, "note", "note_id", false),
+		Revocations: newMongoCollection[model.RevokedToken](db, "revoked_token", "jti", true),
+		UserTokens:  &mongoUserTokenRepository{newMongoCollection[model.UserToken](db, "user_token", "token_hash", false)},
+		APIKeys:     &mongoAPIKeyRepository{newMongoCollection[model.APIKey](db, "api_key", "api_key_id", false)},
+	}
+}
+
+// UniqueKey names a collection and the string key its documents are looked
+// up by.
+type UniqueKey struct {
+	Collection string
+	Key        string
+}
+
+// UniqueKeys are the keys EnsureIndexes makes unique on top of the ones of
+// the expiring collections and API keys. Updates to these collections used
+// to upsert, and the documents they left can repeat or lack a key;
+// cmd/cleanup removes them.
+var UniqueKeys = []UniqueKey{
+	{"order", "order_id"},
+	{"order_item", "order_item_id"},
+	{"table", "table_id"},
+	{"invoice", "invoice_id"},
+	{"user", "user_id"},
+}
+
+// EnsureIndexes creates the indexes the repositories rely on. Revocation
+// entries, user tokens and sessions are removed by Mongo once they expire.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("revoked_token").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("user_token").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("session").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "session_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection("api_key").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "api_key_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Documents are looked up by their string key, and a table may be
+	// created under a key the client picks, so keys must be unique.
+	for _, u := range UniqueKeys {
+		_, err = db.Collection(u.Collection).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: u.Key, Value: 1}},
+			Options: options.Index().SetUnique(true),
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("unique index on %s.%s: %w; remove the documents old updates left behind with go run ./cmd/cleanup -delete, then start again", u.Collection, u.Key, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Listings sorted by created_at page on created_at then _id.
+	for _, name := range []string{"food", "menu", "order", "order_item", "table", "invoice", "user", "api_key"} {
+		_, err = db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	model "github.com/datmedevil17/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when no document matches the requested id.
+var ErrNotFound = errors.New("document not found")
+
+// ErrDuplicateKey is returned when a created document has the key of one that
+// already exists.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// Crud is the set of operations every aggregate repository supports. Ids are
+// the string form of the document key (e.g. "order_id" or the _id hex).
+type Crud[T any] interface {
+	List(ctx context.Context) ([]T, error)
+	// ListPage returns the page of documents q selects, ordered by q.Sort.
+	ListPage(ctx context.Context, q ListQuery) (*Page[T], error)
+	Get(ctx context.Context, id string) (*T, error)
+	Create(ctx context.Context, doc T) (*mongo.InsertOneResult, error)
+	// Update sets fields on the document with id. Only the revocation list
+	// creates a missing document; everywhere else it is ErrNotFound.
+	Update(ctx context.Context, id string, set bson.D) (*mongo.UpdateResult, error)
+	// UpdateAndGet sets fields on an existing document and returns it as it
+	// is after the update, or ErrNotFound if there is no such document.
+	UpdateAndGet(ctx context.Context, id string, set bson.D) (*T, error)
+	Delete(ctx context.Context, id string) (*mongo.DeleteResult, error)
+}
+
+type FoodRepository interface {
+	Crud[model.Food]
+}
+
+type MenuRepository interface {
+	Crud[model.Menu]
+}
+
+type OrderRepository interface {
+	Crud[model.Order]
+}
+
+type OrderItemRepository interface {
+	Crud[model.OrderItem]
+	CreateMany(ctx context.Context, items []model.OrderItem) (*mongo.InsertManyResult, error)
+	ListByOrder(ctx context.Context, orderId string) ([]model.OrderItem, error)
+	ItemsByOrder(ctx context.Context, orderId string) ([]bson.M, error)
+}
+
+type TableRepository interface {
+	Crud[model.Table]
+}
+
+type InvoiceRepository interface {
+	Crud[model.Invoice]
+	// UpdateUnpaid is UpdateAndGet for an invoice that is not PAID yet; one
+	// that is already paid is ErrNotFound, like a missing one.
+	UpdateUnpaid(ctx context.Context, id string, set bson.D) (*model.Invoice, error)
+}
+
+type UserRepository interface {
+	Crud[model.User]
+	Count(ctx context.Context) (int64, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	CountByEmail(ctx context.Context, email string) (int64, error)
+	CountByPhone(ctx context.Context, phone string) (int64, error)
+	// UseTOTPStep records step as the last TOTP step of the user only if it
+	// is later than the recorded one, reporting whether it was.
+	UseTOTPStep(ctx context.Context, userId string, step int64) (bool, error)
+	// UseRecoveryCode removes the recovery code with the given hash from the
+	// user, reporting whether it was still there.
+	UseRecoveryCode(ctx context.Context, userId string, hash string) (bool, error)
+}
+
+// SessionRepository is keyed by session_id.
+type SessionRepository interface {
+	Crud[model.Session]
+	// Rotate replaces the refresh id of the session only if it is still
+	// current, reporting whether it was.
+	Rotate(ctx context.Context, sessionId string, current string, next string, expiresAt time.Time) (bool, error)
+}
+
+type NoteRepository interface {
+	Crud[model.Note]
+}
+
+// RevocationRepository is keyed by jti, and upserts so revoking twice is
+// harmless.
+type RevocationRepository interface {
+	Crud[model.RevokedToken]
+}
+
+// UserTokenRepository is keyed by token_hash.
+type UserTokenRepository interface {
+	Crud[model.UserToken]
+	// Consume marks the unused, unexpired token with the given hash and
+	// purpose as used and returns it, or ErrNotFound if there is none.
+	Consume(ctx context.Context, tokenHash string, purpose string) (*model.UserToken, error)
+}
+
+// APIKeyRepository is keyed by api_key_id.
+type APIKeyRepository interface {
+	Crud[model.APIKey]
+	GetByHash(ctx context.Context, keyHash string) (*model.APIKey, error)
+}
+
+// Repositories groups one repository per aggregate so controllers can be
+// handed a single value.
+type Repositories struct {
+	Foods       FoodRepository
+	Menus       MenuRepository
+	Orders      OrderRepository
+	OrderItems  OrderItemRepository
+	Tables      TableRepository
+	Invoices    InvoiceRepository
+	Users       UserRepository
+	Sessions    SessionRepository
+	Notes       NoteRepository
+	Revocations RevocationRepository
+	UserTokens  UserTokenRepository
+	APIKeys     APIKeyRepository
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/datmedevil17/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ids that are not ObjectID hex cannot match anything, and both
+// implementations must say so the same way, without a round trip.
+func TestMalformedObjectIDIsNotFound(t *testing.T) {
+	ctx := context.Background()
+	// The driver connects lazily, and none of these calls reaches the
+	// server.
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Disconnect(ctx)
+
+	for name, repos := range map[string]*Repositories{
+		"memory": NewMemory(),
+		"mongo":  NewMongo(client.Database("test")),
+	} {
+		if _, err := repos.Menus.Get(ctx, "not-hex"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: Get: got %v, want ErrNotFound", name, err)
+		}
+		if _, err := repos.Foods.UpdateAndGet(ctx, "not-hex", bson.D{{Key: "name", Value: "x"}}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: UpdateAndGet: got %v, want ErrNotFound", name, err)
+		}
+		result, err := repos.Menus.Delete(ctx, "not-hex")
+		if err != nil || result.DeletedCount != 0 {
+			t.Errorf("%s: Delete: got %+v, %v, want nothing deleted", name, result, err)
+		}
+	}
+}
+
+// Of two uses of the same TOTP step or recovery code only the first may
+// succeed, however close together they come.
+func TestSecondFactorsAreUsedOnce(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemory()
+	user := model.User{ID: primitive.NewObjectID(), User_id: "u1", Totp_last_step: 10, Recovery_codes: []string{"a", "b"}}
+	if _, err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		use  func() (bool, error)
+		want bool
+	}{
+		{"earlier step", func() (bool, error) { return repos.Users.UseTOTPStep(ctx, "u1", 9) }, false},
+		{"recorded step", func() (bool, error) { return repos.Users.UseTOTPStep(ctx, "u1", 10) }, false},
+		{"later step", func() (bool, error) { return repos.Users.UseTOTPStep(ctx, "u1", 11) }, true},
+		{"later step again", func() (bool, error) { return repos.Users.UseTOTPStep(ctx, "u1", 11) }, false},
+		{"recovery code", func() (bool, error) { return repos.Users.UseRecoveryCode(ctx, "u1", "a") }, true},
+		{"recovery code again", func() (bool, error) { return repos.Users.UseRecoveryCode(ctx, "u1", "a") }, false},
+		{"unknown user", func() (bool, error) { return repos.Users.UseRecoveryCode(ctx, "u2", "b") }, false},
+	} {
+		if got, err := tc.use(); err != nil || got != tc.want {
+			t.Errorf("%s: got %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+	}
+
+	stored, err := repos.Users.Get(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Totp_last_step != 11 || len(stored.Recovery_codes) != 1 || stored.Recovery_codes[0] != "b" {
+		t.Errorf("stored step %d and codes %v, want 11 and [b]", stored.Totp_last_step, stored.Recovery_codes)
+	}
+}
+
+// Only the update that makes an invoice paid may count it as revenue.
+func TestInvoicesArePaidOnce(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemory()
+	pending := "PENDING"
+	if _, err := repos.Invoices.Create(ctx, model.Invoice{ID: primitive.NewObjectID(), Invoice_id: "i1", Payment_status: &pending}); err != nil {
+		t.Fatal(err)
+	}
+
+	paid := bson.D{{Key: "payment_status", Value: "PAID"}}
+	invoice, err := repos.Invoices.UpdateUnpaid(ctx, "i1", paid)
+	if err != nil || invoice.Payment_status == nil || *invoice.Payment_status != "PAID" {
+		t.Fatalf("first payment: got %+v, %v", invoice, err)
+	}
+	if _, err := repos.Invoices.UpdateUnpaid(ctx, "i1", paid); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second payment: got %v, want ErrNotFound", err)
+	}
+	if _, err := repos.Invoices.UpdateUnpaid(ctx, "i2", paid); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing invoice: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "github.com/datmedevil17/restaurant-management/controllers"
+	"github.com/gorilla/mux"
+)
+
+func APIKeyRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/api-keys", restrict(c.GetAPIKeys, adminsOnly)).Methods("GET")
+	r.Handle("/api-keys/{api_key_id}", restrict(c.GetAPIKey, adminsOnly)).Methods("GET")
+	r.Handle("/api-keys", restrict(c.CreateAPIKey, adminsOnly)).Methods("POST")
+	r.Handle("/api-keys/{api_key_id}", restrict(c.RevokeAPIKey, adminsOnly)).Methods("DELETE")
+}
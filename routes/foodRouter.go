@@ -5,10 +5,10 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func FoodRoutes(r *mux.Router) {
-	r.HandleFunc("/foods", controller.GetFoods).Methods("GET")
-	r.HandleFunc("/foods/{food_id}", controller.GetFood).Methods("GET")
-	r.HandleFunc("/foods", controller.CreateFood).Methods("POST")
-	r.HandleFunc("/foods/{food_id}", controller.UpdateFood).Methods("PATCH")
-	r.HandleFunc("/foods/{food_id}", controller.DeleteFood).Methods("DELETE")
+func FoodRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/foods", restrict(c.GetFoods, allStaff)).Methods("GET")
+	r.Handle("/foods/{food_id}", restrict(c.GetFood, allStaff)).Methods("GET")
+	r.Handle("/foods", restrict(c.CreateFood, managers)).Methods("POST")
+	r.Handle("/foods/{food_id}", restrict(c.UpdateFood, managers)).Methods("PATCH")
+	r.Handle("/foods/{food_id}", restrict(c.DeleteFood, managers)).Methods("DELETE")
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	controller "github.com/datmedevil17/restaurant-management/controllers"
+	"github.com/gorilla/mux"
+)
+
+// HealthRoutes are for orchestrators and need no authentication.
+func HealthRoutes(r *mux.Router, c *controller.Controller) {
+	r.HandleFunc("/healthz", c.HealthCheck).Methods("GET")
+	r.HandleFunc("/readyz", c.ReadyCheck).Methods("GET")
+	r.HandleFunc("/version", c.GetVersion).Methods("GET")
+}
@@ -5,11 +5,11 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func InvoiceRoutes(r *mux.Router) {
-	r.HandleFunc("/invoices", controller.GetInvoices).Methods("GET")
-	r.HandleFunc("/invoices/{invoice_id}", controller.GetInvoice).Methods("GET")
-	r.HandleFunc("/invoices", controller.CreateInvoice).Methods("POST")
-	r.HandleFunc("/invoices/{invoice_id}", controller.UpdateInvoice).Methods("PUT")
-	r.HandleFunc("/invoices/{invoice_id}", controller.DeleteInvoice).Methods("DELETE")
+func InvoiceRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/invoices", restrict(c.GetInvoices, billingStaff)).Methods("GET")
+	r.Handle("/invoices/{invoice_id}", restrict(c.GetInvoice, billingStaff)).Methods("GET")
+	r.Handle("/invoices", restrict(c.CreateInvoice, billingStaff)).Methods("POST")
+	r.Handle("/invoices/{invoice_id}", restrict(c.UpdateInvoice, billingStaff)).Methods("PUT", "PATCH")
+	r.Handle("/invoices/{invoice_id}", restrict(c.DeleteInvoice, managers)).Methods("DELETE")
 
 }
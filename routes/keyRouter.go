@@ -0,0 +1,10 @@
+package routes
+
+import (
+	controller "github.com/datmedevil17/restaurant-management/controllers"
+	"github.com/gorilla/mux"
+)
+
+func KeyRoutes(r *mux.Router, c *controller.Controller) {
+	r.HandleFunc("/.well-known/jwks.json", c.GetJWKS).Methods("GET")
+}
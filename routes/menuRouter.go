@@ -5,11 +5,11 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func MenuRoutes(r *mux.Router) {
-	r.HandleFunc("/menus", controller.GetMenus).Methods("GET")
-	r.HandleFunc("/menus/{menu_id}", controller.GetMenu).Methods("GET")
-	r.HandleFunc("/menus", controller.CreateMenu).Methods("POST")
-	r.HandleFunc("/menus/{menu_id}", controller.UpdateMenu).Methods("PUT")
-	r.HandleFunc("/menus/{menu_id}", controller.DeleteMenu).Methods("DELETE")
+func MenuRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/menus", restrict(c.GetMenus, allStaff)).Methods("GET")
+	r.Handle("/menus/{menu_id}", restrict(c.GetMenu, allStaff)).Methods("GET")
+	r.Handle("/menus", restrict(c.CreateMenu, managers)).Methods("POST")
+	r.Handle("/menus/{menu_id}", restrict(c.UpdateMenu, managers)).Methods("PUT", "PATCH")
+	r.Handle("/menus/{menu_id}", restrict(c.DeleteMenu, managers)).Methods("DELETE")
 
 }
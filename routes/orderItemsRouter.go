@@ -5,12 +5,12 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func OrderItemRoutes(r *mux.Router) {
-	r.HandleFunc("/order-items", controller.GetOrderItems).Methods("GET")
-	r.HandleFunc("/order-items/{order_item_id}", controller.GetOrderItem).Methods("GET")
-	r.HandleFunc("/order-items-order/{order_item_id}", controller.GetOrderItemsByOrder).Methods("GET")
-	r.HandleFunc("/order-items", controller.CreateOrderItem).Methods("POST")
+func OrderItemRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/order-items", restrict(c.GetOrderItems, allStaff)).Methods("GET")
+	r.Handle("/order-items/{order_item_id}", restrict(c.GetOrderItem, allStaff)).Methods("GET")
+	r.Handle("/order-items-order/{order_id}", restrict(c.GetOrderItemsByOrder, allStaff)).Methods("GET")
+	r.Handle("/order-items", restrict(c.CreateOrderItem, floorStaff)).Methods("POST")
 
-	r.HandleFunc("/order-items/{order_item_id}", controller.UpdateOrderItem).Methods("PUT")
-	r.HandleFunc("/order-items/{order_item_id}", controller.DeleteOrderItem).Methods("DELETE")
+	r.Handle("/order-items/{order_item_id}", restrict(c.UpdateOrderItem, kitchenStaff)).Methods("PUT", "PATCH")
+	r.Handle("/order-items/{order_item_id}", restrict(c.DeleteOrderItem, floorStaff)).Methods("DELETE")
 }
@@ -5,10 +5,10 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func OrderRoutes(r *mux.Router) {
-	r.HandleFunc("/orders", controller.GetOrders).Methods("GET")
-	r.HandleFunc("/orders/{order_id}", controller.GetOrder).Methods("GET")
-	r.HandleFunc("/orders", controller.CreateOrder).Methods("POST")
-	r.HandleFunc("/orders/{order_id}", controller.UpdateOrder).Methods("PUT")
-	r.HandleFunc("/orders/{order_id}", controller.DeleteOrder).Methods("DELETE")
+func OrderRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/orders", restrict(c.GetOrders, allStaff)).Methods("GET")
+	r.Handle("/orders/{order_id}", restrict(c.GetOrder, allStaff)).Methods("GET")
+	r.Handle("/orders", restrict(c.CreateOrder, floorStaff)).Methods("POST")
+	r.Handle("/orders/{order_id}", restrict(c.UpdateOrder, floorStaff)).Methods("PUT", "PATCH")
+	r.Handle("/orders/{order_id}", restrict(c.DeleteOrder, managers)).Methods("DELETE")
 }
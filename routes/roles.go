@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"net/http"
+
+	"github.com/datmedevil17/restaurant-management/middlewares"
+	model "github.com/datmedevil17/restaurant-management/models"
+)
+
+// Role groups shared by the route files. Admins pass every check, so they are
+// never listed explicitly.
+var (
+	adminsOnly   = []string{}
+	managers     = []string{model.RoleManager}
+	floorStaff   = []string{model.RoleManager, model.RoleWaiter}
+	kitchenStaff = []string{model.RoleManager, model.RoleWaiter, model.RoleKitchen}
+	billingStaff = []string{model.RoleManager, model.RoleCashier}
+	allStaff     = []string{model.RoleManager, model.RoleWaiter, model.RoleKitchen, model.RoleCashier}
+)
+
+// restrict guards h with middlewares.RequireRole(roles...).
+func restrict(h http.HandlerFunc, roles []string) http.Handler {
+	return middlewares.RequireRole(roles...)(h)
+}
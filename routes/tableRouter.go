@@ -5,11 +5,14 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func TableRoutes(r *mux.Router) {
-	r.HandleFunc("/tables", controller.GetTables).Methods("GET")
-	r.HandleFunc("/tables/{table_id}", controller.GetTable).Methods("GET")
-	r.HandleFunc("/tables", controller.CreateTable).Methods("POST")
-	r.HandleFunc("/tables/{table_id}", controller.UpdateTable).Methods("PUT")
-	r.HandleFunc("/tables/{table_id}", controller.DeleteTable).Methods("DELETE")
+func TableRoutes(r *mux.Router, c *controller.Controller) {
+	r.Handle("/tables", restrict(c.GetTables, allStaff)).Methods("GET")
+	r.Handle("/tables/{table_id}", restrict(c.GetTable, allStaff)).Methods("GET")
+	r.Handle("/tables", restrict(c.CreateTable, managers)).Methods("POST")
+	// PUT creates a table only when asked to with If-None-Match: *, and
+	// only managers may create tables.
+	r.Handle("/tables/{table_id}", restrict(c.CreateTableAt, managers)).Methods("PUT").Headers("If-None-Match", "*")
+	r.Handle("/tables/{table_id}", restrict(c.UpdateTable, floorStaff)).Methods("PUT", "PATCH")
+	r.Handle("/tables/{table_id}", restrict(c.DeleteTable, managers)).Methods("DELETE")
 
 }
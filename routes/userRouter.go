@@ -5,12 +5,37 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func UserRoutes(r *mux.Router) {
-	r.HandleFunc("/users/signup", controller.SignUp).Methods("POST")
-	r.HandleFunc("/users/login", controller.Login).Methods("POST")
+func UserRoutes(r *mux.Router, c *controller.Controller) {
+	r.HandleFunc("/users/signup", c.SignUp).Methods("POST")
+	r.HandleFunc("/users/login", c.Login).Methods("POST")
+	r.HandleFunc("/users/login/mfa", c.LoginMFA).Methods("POST")
+	r.HandleFunc("/users/refresh", c.Refresh).Methods("POST")
+	r.HandleFunc("/users/password/forgot", c.ForgotPassword).Methods("POST")
+	r.HandleFunc("/users/password/reset", c.ResetPassword).Methods("POST")
+	r.HandleFunc("/users/email/verify", c.VerifyEmail).Methods("POST")
 }
 
-func UserProtectedRoutes(r *mux.Router) {
-	r.HandleFunc("/users", controller.GetUsers).Methods("GET")
-	r.HandleFunc("/users/{user_id}", controller.GetUser).Methods("GET")
+func UserProtectedRoutes(r *mux.Router, c *controller.Controller) {
+	r.HandleFunc("/users/logout", c.Logout).Methods("POST")
+	r.HandleFunc("/users/email/resend", c.ResendEmailVerification).Methods("POST")
+	r.HandleFunc("/users/mfa/totp/disable", c.DisableTOTP).Methods("POST")
+	r.HandleFunc("/users/mfa/recovery-codes", c.RegenerateRecoveryCodes).Methods("POST")
+	r.Handle("/users", restrict(c.GetUsers, managers)).Methods("GET")
+	r.HandleFunc("/users/{user_id}", c.GetUser).Methods("GET")
+	r.HandleFunc("/users/{user_id}", c.UpdateUser).Methods("PATCH")
+	r.HandleFunc("/users/{user_id}", c.DeleteUser).Methods("DELETE")
+	r.HandleFunc("/users/{user_id}/password", c.ChangePassword).Methods("POST")
+	r.HandleFunc("/users/{user_id}/deactivate", c.DeactivateUser).Methods("POST")
+	r.Handle("/users/{user_id}/reactivate", restrict(c.ReactivateUser, adminsOnly)).Methods("POST")
+	r.Handle("/users/{user_id}/role", restrict(c.UpdateUserRole, adminsOnly)).Methods("PUT")
+	r.Handle("/users/{user_id}/unlock", restrict(c.UnlockUser, adminsOnly)).Methods("POST")
+	r.Handle("/users/{user_id}/revoke-sessions", restrict(c.RevokeSessions, adminsOnly)).Methods("POST")
+	r.Handle("/users/{user_id}/mfa", restrict(c.ResetMFA, adminsOnly)).Methods("DELETE")
+}
+
+// MFAEnrolmentRoutes are reachable with an access token or with the
+// mfa_pending token of a login that requires enrolment first.
+func MFAEnrolmentRoutes(r *mux.Router, c *controller.Controller) {
+	r.HandleFunc("/users/mfa/totp/setup", c.SetupTOTP).Methods("POST")
+	r.HandleFunc("/users/mfa/totp/confirm", c.ConfirmTOTP).Methods("POST")
 }